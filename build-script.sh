@@ -4,7 +4,8 @@ directory="$1"
 if [ -n "$directory" ] && [ -d "$directory" ]
 then
 	cd "$directory"
-	targetScripts=`ls | grep -E "*go"`
+	# Тесты (*_test.go) — не отдельные программы, их не собираем
+	targetScripts=`ls | grep -E "\.go$" | grep -v "_test\.go$"`
 	# Создаем go.mod если его нет
 	if [ ! -f "go.mod" ]; then
  	   	go mod init myapp
@@ -16,10 +17,17 @@ then
 		# Отделяем расширение от имени файла
         	exename="${gofile%.go}"
         	echo "Building $exename"
-        	go build -o "$exename" "$gofile"
+        	if ! go build -o "$exename" "$gofile"; then
+        		failed="$failed $gofile"
+        	fi
 	done
 
 	echo ""
+	if [ -n "$failed" ]; then
+		echo "Build failed:$failed"
+		echo ""
+		exit 1
+	fi
 	echo "Build successful"
 	echo ""
 	exit 0
@@ -2,14 +2,32 @@ package main
 
 import (
 	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/flate"
 	"compress/gzip"
+	"compress/zlib"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"os"
+	"os/user"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
+	"unsafe"
 )
 
 func main() {
@@ -17,9 +35,46 @@ func main() {
 	create := flag.Bool("c", false, "создать новый архив")
 	extract := flag.Bool("x", false, "извлечь файлы из архива")
 	list := flag.Bool("t", false, "вывести список файлов в архиве")
+	appendFlag := flag.Bool("r", false, "дописать файлы в конец архива")
+	update := flag.Bool("u", false, "дописать только файлы, более новые, чем в архиве")
+	var diff bool
+	flag.BoolVar(&diff, "d", false, "сравнить архив с файловой системой")
+	flag.BoolVar(&diff, "diff", false, "сравнить архив с файловой системой")
 	verbose := flag.Bool("v", false, "подробный вывод (verbose)")
 	gzipFlag := flag.Bool("z", false, "использовать сжатие gzip")
+	bzip2Flag := flag.Bool("j", false, "использовать сжатие bzip2 (только чтение)")
+	lzwFlag := flag.Bool("Z", false, "использовать сжатие compress (.Z, только чтение)")
 	file := flag.String("f", "", "имя архивного файла (обязательный параметр)")
+	directory := flag.String("C", "", "извлекать файлы в указанную директорию")
+	stripComponents := flag.Int("strip-components", 0, "удалить N начальных элементов пути при извлечении")
+	preservePerms := flag.Bool("p", false, "восстанавливать точные права доступа при извлечении")
+	sameOwner := flag.Bool("same-owner", false, "восстанавливать владельца и группу при извлечении")
+	xattrs := flag.Bool("xattrs", false, "сохранять и восстанавливать расширенные атрибуты")
+	var excludes, excludeFrom stringList
+	flag.Var(&excludes, "exclude", "исключить файлы по шаблону (можно указывать несколько раз)")
+	flag.Var(&excludeFrom, "exclude-from", "читать шаблоны исключения из файла")
+	excludeVCS := flag.Bool("exclude-vcs", false, "исключить служебные файлы систем контроля версий")
+	threads := flag.Int("threads", runtime.NumCPU(), "число потоков сжатия gzip")
+	gzipBlock := flag.String("gzip-block-size", "128K", "размер блока параллельного сжатия gzip")
+	sortOrder := flag.String("sort", "none", "порядок членов архива: none или name")
+	mtime := flag.String("mtime", "", "записывать ДАТУ как время модификации всех файлов")
+	clampMtime := flag.Bool("clamp-mtime", false, "с --mtime: заменять только более позднее время")
+	owner := flag.String("owner", "", "записывать владельца ИМЯ[:UID]")
+	group := flag.String("group", "", "записывать группу ИМЯ[:GID]")
+	numericOwner := flag.Bool("numeric-owner", false, "не записывать имена владельца и группы")
+	var verify bool
+	flag.BoolVar(&verify, "W", false, "проверить архив после записи")
+	flag.BoolVar(&verify, "verify", false, "проверить архив после записи")
+	manifest := flag.String("manifest", "", "записать контрольные суммы SHA-256 членов архива в ФАЙЛ")
+	var multiVolume bool
+	flag.BoolVar(&multiVolume, "M", false, "многотомный архив")
+	flag.BoolVar(&multiVolume, "multi-volume", false, "многотомный архив")
+	var tapeLength string
+	flag.StringVar(&tapeLength, "L", "", "размер тома многотомного архива")
+	flag.StringVar(&tapeLength, "tape-length", "", "размер тома многотомного архива")
+	listFormat := flag.String("format", listFormatText, "формат вывода списка: text, json или csv")
+	listedIncremental := flag.String("listed-incremental", "", "инкрементальный архив с файлом снимка СНИМОК")
+	unsafePaths := flag.Bool("unsafe-paths", false, "отключить проверку путей при извлечении (только для доверенных архивов)")
 	help := flag.Bool("help", false, "показать справку")
 
 	// Настраиваем вывод справки
@@ -53,16 +108,88 @@ func main() {
 	if *list {
 		ops++
 	}
+	if *appendFlag {
+		ops++
+	}
+	if *update {
+		ops++
+	}
+	if diff {
+		ops++
+	}
 
 	if ops != 1 {
-		fmt.Fprintln(os.Stderr, "Ошибка: необходимо указать ровно одну операцию: -c, -x или -t")
+		fmt.Fprintln(os.Stderr, "Ошибка: необходимо указать ровно одну операцию: -c, -r, -u, -x, -t или -d")
 		fmt.Fprintln(os.Stderr, "Используйте 'tar --help' для получения дополнительной информации.")
 		os.Exit(1)
 	}
 
+	// Инкрементальный режим поддерживается только при создании и извлечении
+	if *listedIncremental != "" && !*create && !*extract {
+		fmt.Fprintln(os.Stderr, "Ошибка: --listed-incremental используется только с -c или -x")
+		os.Exit(1)
+	}
+
+	// Проверка и манифест доступны только при создании архива
+	if (verify || *manifest != "") && !*create {
+		fmt.Fprintln(os.Stderr, "Ошибка: -W и --manifest используются только с -c")
+		os.Exit(1)
+	}
+
+	// Машинно-читаемый вывод поддерживается только для списка
+	switch *listFormat {
+	case listFormatText, listFormatJSON, listFormatCSV:
+	default:
+		fmt.Fprintf(os.Stderr, "Ошибка: неизвестный формат вывода: %s (допустимо text, json, csv)\n", *listFormat)
+		os.Exit(1)
+	}
+	if *listFormat != listFormatText && !*list {
+		fmt.Fprintln(os.Stderr, "Ошибка: --format используется только с -t")
+		os.Exit(1)
+	}
+
+	// Многотомный архив: -L задает размер тома и подразумевает -M
+	var volumeSize int64
+	if tapeLength != "" {
+		var err error
+		volumeSize, err = parseSize(tapeLength)
+		if err != nil || volumeSize < blockSize || volumeSize%blockSize != 0 {
+			fmt.Fprintf(os.Stderr, "Ошибка: неверный размер тома: %s (должен быть кратен %d байтам)\n", tapeLength, blockSize)
+			os.Exit(1)
+		}
+		multiVolume = true
+	}
+	if multiVolume {
+		if *appendFlag || *update {
+			fmt.Fprintln(os.Stderr, "Ошибка: -M нельзя использовать с -r и -u")
+			os.Exit(1)
+		}
+		if *create && volumeSize == 0 {
+			fmt.Fprintln(os.Stderr, "Ошибка: для создания многотомного архива укажите размер тома с помощью -L")
+			os.Exit(1)
+		}
+		if *file == stdioName {
+			fmt.Fprintln(os.Stderr, "Ошибка: многотомный архив не может читаться из stdin или писаться в stdout")
+			os.Exit(1)
+		}
+	}
+
+	// Проверяем параметры извлечения
+	if *stripComponents < 0 {
+		fmt.Fprintln(os.Stderr, "Ошибка: значение --strip-components не может быть отрицательным")
+		os.Exit(1)
+	}
+
+	// Определяем запрошенный формат сжатия
+	comp, err := compressionFromFlags(*gzipFlag, *bzip2Flag, *lzwFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка: %v\n", err)
+		os.Exit(1)
+	}
+
 	// Получаем список файлов для операций
 	var files []string
-	if *create {
+	if *create || *appendFlag || *update {
 		files = flag.Args()
 		if len(files) == 0 {
 			files = []string{"."} // По умолчанию архивируем текущую директорию
@@ -70,13 +197,56 @@ func main() {
 	}
 
 	// Выполняем операцию
-	var err error
-	if *create {
-		err = createArchive(*file, files, *verbose, *gzipFlag)
+	if *create || *appendFlag || *update {
+		opts := createOptions{
+			xattrs:            *xattrs,
+			listedIncremental: *listedIncremental,
+			threads:           *threads,
+			verify:            verify,
+			manifest:          *manifest,
+			volumeSize:        volumeSize,
+		}
+		opts.gzipBlockSize, err = parseSize(*gzipBlock)
+		if err != nil || opts.gzipBlockSize < minGzipBlockSize || opts.gzipBlockSize > maxGzipBlockSize {
+			fmt.Fprintf(os.Stderr, "Ошибка: неверный размер блока gzip: %s (допустимо от %s до %s)\n",
+				*gzipBlock, formatBytes(minGzipBlockSize), formatBytes(maxGzipBlockSize))
+			os.Exit(1)
+		}
+		if *threads < 1 {
+			fmt.Fprintln(os.Stderr, "Ошибка: число потоков --threads должно быть не меньше 1")
+			os.Exit(1)
+		}
+		if err := opts.setReproducible(*sortOrder, *mtime, *clampMtime, *owner, *group, *numericOwner); err != nil {
+			fmt.Fprintf(os.Stderr, "Ошибка: %v\n", err)
+			os.Exit(1)
+		}
+		opts.exclude, err = loadExcludePatterns(excludes, excludeFrom, *excludeVCS)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Ошибка: %v\n", err)
+			os.Exit(1)
+		}
+		if *create {
+			err = createArchive(*file, files, *verbose, comp, opts)
+		} else {
+			err = appendArchive(*file, files, *verbose, *update, comp, opts)
+		}
 	} else if *extract {
-		err = extractArchive(*file, *verbose, *gzipFlag)
+		opts := extractOptions{
+			destDir:         *directory,
+			stripComponents: *stripComponents,
+			filter:          newMemberFilter(flag.Args()),
+			preservePerms:   *preservePerms,
+			sameOwner:       *sameOwner,
+			xattrs:          *xattrs,
+			unsafePaths:     *unsafePaths,
+			incremental:     *listedIncremental != "",
+			multiVolume:     multiVolume,
+		}
+		err = extractArchive(*file, *verbose, comp, opts)
 	} else if *list {
-		err = listArchive(*file, *verbose, *gzipFlag)
+		err = listArchive(*file, *verbose, comp, multiVolume, *listFormat, newMemberFilter(flag.Args()))
+	} else if diff {
+		err = diffArchive(*file, *directory, *verbose, comp, multiVolume, newMemberFilter(flag.Args()))
 	}
 
 	if err != nil {
@@ -85,396 +255,3111 @@ func main() {
 	}
 }
 
-func createArchive(filename string, files []string, verbose, gzipCompress bool) error {
-	// Создаем выходной файл
-	out, err := os.Create(filename)
+// createOptions — параметры создания архива
+type createOptions struct {
+	xattrs            bool
+	exclude           []string
+	listedIncremental string
+	threads           int
+	gzipBlockSize     int64
+	verify            bool
+	manifest          string
+	volumeSize        int64
+
+	// Параметры воспроизводимых архивов
+	sortByName   bool
+	mtime        time.Time
+	clampMtime   bool
+	owner        *idOverride
+	group        *idOverride
+	numericOwner bool
+}
+
+// idOverride — имя и идентификатор, записываемые вместо настоящих
+type idOverride struct {
+	name string
+	id   int
+}
+
+// setReproducible разбирает параметры воспроизводимых архивов
+func (o *createOptions) setReproducible(sortOrder, mtime string, clamp bool, owner, group string, numeric bool) error {
+	switch sortOrder {
+	case "none":
+	case "name":
+		o.sortByName = true
+	default:
+		return fmt.Errorf("неверный порядок --sort: %s (допустимо none или name)", sortOrder)
+	}
+
+	if mtime != "" {
+		t, err := parseMtime(mtime)
+		if err != nil {
+			return err
+		}
+		o.mtime = t
+	} else if clamp {
+		return fmt.Errorf("--clamp-mtime требует --mtime")
+	}
+	o.clampMtime = clamp
+
+	var err error
+	if owner != "" {
+		if o.owner, err = parseIDOverride(owner, lookupUID); err != nil {
+			return fmt.Errorf("неверное значение --owner: %v", err)
+		}
+	}
+	if group != "" {
+		if o.group, err = parseIDOverride(group, lookupGID); err != nil {
+			return fmt.Errorf("неверное значение --group: %v", err)
+		}
+	}
+	o.numericOwner = numeric
+	return nil
+}
+
+// applyOverrides подменяет в заголовке время и владельца
+func (o *createOptions) applyOverrides(header *tar.Header) {
+	if !o.mtime.IsZero() && (!o.clampMtime || header.ModTime.After(o.mtime)) {
+		header.ModTime = o.mtime
+	}
+	if o.owner != nil {
+		header.Uname = o.owner.name
+		header.Uid = o.owner.id
+	}
+	if o.group != nil {
+		header.Gname = o.group.name
+		header.Gid = o.group.id
+	}
+	if o.numericOwner {
+		header.Uname = ""
+		header.Gname = ""
+	}
+}
+
+// parseMtime разбирает дату для --mtime: @секунды, дату в одном из
+// распространенных форматов или путь к файлу, чье время будет взято
+func parseMtime(value string) (time.Time, error) {
+	if strings.HasPrefix(value, "@") {
+		sec, err := strconv.ParseInt(value[1:], 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("неверная дата --mtime: %s", value)
+		}
+		return time.Unix(sec, 0), nil
+	}
+
+	// Как в GNU tar: значение, начинающееся с / или ., — это файл
+	if strings.HasPrefix(value, "/") || strings.HasPrefix(value, ".") {
+		info, err := os.Stat(value)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("--mtime: %v", err)
+		}
+		return info.ModTime().Truncate(time.Second), nil
+	}
+
+	formats := []string{
+		time.RFC3339,
+		"2006-01-02 15:04:05 -0700",
+		"2006-01-02 15:04:05",
+		"2006-01-02 15:04",
+		"2006-01-02",
+	}
+	for _, layout := range formats {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("неверная дата --mtime: %s", value)
+}
+
+// parseIDOverride разбирает значение ИМЯ[:ID]. Если указано только
+// число, имя не записывается; если только имя, идентификатор ищется
+// в системе (0, если такого пользователя или группы нет).
+func parseIDOverride(value string, lookup func(string) (int, error)) (*idOverride, error) {
+	name, idStr, hasID := strings.Cut(value, ":")
+	if hasID {
+		id, err := strconv.Atoi(idStr)
+		if err != nil || id < 0 {
+			return nil, fmt.Errorf("неверный идентификатор: %s", idStr)
+		}
+		return &idOverride{name: name, id: id}, nil
+	}
+	if id, err := strconv.Atoi(name); err == nil {
+		if id < 0 {
+			return nil, fmt.Errorf("неверный идентификатор: %s", name)
+		}
+		return &idOverride{id: id}, nil
+	}
+	id, err := lookup(name)
+	if err != nil {
+		id = 0
+	}
+	return &idOverride{name: name, id: id}, nil
+}
+
+func lookupUID(name string) (int, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(u.Uid)
+}
+
+func lookupGID(name string) (int, error) {
+	g, err := user.LookupGroup(name)
 	if err != nil {
-		return fmt.Errorf("не удалось создать файл %s: %v", filename, err)
+		return 0, err
+	}
+	return strconv.Atoi(g.Gid)
+}
+
+// stringList — флаг, который можно указать несколько раз
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// vcsPatterns — служебные файлы и директории систем контроля версий
+var vcsPatterns = []string{
+	"CVS", ".cvsignore",
+	"RCS", "SCCS",
+	".git", ".gitignore", ".gitmodules", ".gitattributes",
+	".bzr", ".bzrignore", ".bzrtags",
+	".hg", ".hgignore", ".hgtags",
+	"_darcs", ".svn",
+	"{arch}", ".arch-ids",
+}
+
+// loadExcludePatterns собирает шаблоны исключения из --exclude,
+// файлов --exclude-from и списка --exclude-vcs
+func loadExcludePatterns(excludes, files []string, vcs bool) ([]string, error) {
+	patterns := append([]string{}, excludes...)
+
+	for _, name := range files {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("не удалось прочитать файл исключений %s: %v", name, err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimRight(line, "\r")
+			if line != "" {
+				patterns = append(patterns, line)
+			}
+		}
+	}
+
+	if vcs {
+		patterns = append(patterns, vcsPatterns...)
+	}
+
+	// Проверяем корректность шаблонов заранее
+	for _, pattern := range patterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("неверный шаблон исключения %q: %v", pattern, err)
+		}
+	}
+
+	return patterns, nil
+}
+
+func createArchive(filename string, files []string, verbose bool, comp compression, opts createOptions) error {
+	// При создании поддерживается только gzip
+	if comp != compressNone && comp != compressGzip {
+		return fmt.Errorf("создание архивов со сжатием %s не поддерживается", comp)
+	}
+	if opts.verify && filename == stdioName {
+		return fmt.Errorf("проверка -W невозможна при записи в стандартный вывод")
+	}
+	if opts.manifest == stdioName && filename == stdioName {
+		return fmt.Errorf("манифест и архив не могут одновременно выводиться в стандартный вывод")
+	}
+	if opts.volumeSize > 0 && comp != compressNone {
+		return fmt.Errorf("многотомные архивы не могут быть сжатыми")
 	}
-	defer out.Close()
 
-	var writer io.Writer = out
+	// Создаем выходной файл; "-" означает стандартный вывод,
+	// и тогда сообщения выводятся в stderr, чтобы не смешиваться с архивом.
+	// Многотомный архив пишется в тома, которые создаются по мере записи
+	var writer io.Writer
+	var volumes *volumeWriter
+	var removable bool
+	msg := io.Writer(os.Stdout)
+	if opts.volumeSize > 0 {
+		volumes = &volumeWriter{base: filename, limit: opts.volumeSize}
+		if verbose {
+			volumes.log = msg
+		}
+		defer volumes.Close()
+		writer = volumes
+	} else if filename == stdioName {
+		writer = os.Stdout
+		msg = os.Stderr
+	} else {
+		out, err := os.Create(filename)
+		if err != nil {
+			return fmt.Errorf("не удалось создать файл %s: %v", filename, err)
+		}
+		defer out.Close()
+		writer = out
+		if fi, err := out.Stat(); err == nil && fi.Mode().IsRegular() {
+			removable = true
+		}
+	}
 
-	// Добавляем gzip сжатие если нужно
-	if gzipCompress {
-		gzWriter := gzip.NewWriter(writer)
-		defer gzWriter.Close()
-		writer = gzWriter
+	// Недописанный архив удаляется: он оборвался бы на середине члена.
+	// Устройства вроде /dev/st0 не трогаем
+	written := false
+	defer func() {
+		if written {
+			return
+		}
+		if volumes != nil {
+			volumes.discard()
+		} else if removable {
+			os.Remove(filename)
+		}
+	}()
+
+	// Добавляем gzip сжатие если нужно; при нескольких потоках
+	// блоки сжимаются параллельно
+	var compressor io.WriteCloser
+	if comp == compressGzip {
+		if opts.threads > 1 {
+			compressor = newParallelGzipWriter(writer, opts.threads, int(opts.gzipBlockSize))
+		} else {
+			compressor = gzip.NewWriter(writer)
+		}
+		writer = compressor
 		if verbose {
-			fmt.Println("Используется сжатие gzip")
+			fmt.Fprintf(msg, "Используется сжатие gzip (потоков: %d)\n", opts.threads)
 		}
 	}
 
 	tw := tar.NewWriter(writer)
-	defer tw.Close()
 
 	if verbose {
-		fmt.Printf("Создание архива: %s\n", filename)
-		fmt.Println("Добавляемые файлы:")
+		fmt.Fprintf(msg, "Создание архива: %s\n", filename)
+		fmt.Fprintln(msg, "Добавляемые файлы:")
 	}
 
-	addedCount := 0
-	totalSize := int64(0)
+	aw := &archiveWriter{tw: tw, verbose: verbose, opts: opts, log: msg}
 
-	// Обрабатываем каждый файл/шаблон
-	for _, pattern := range files {
-		// Разворачиваем шаблоны
-		matches, err := filepath.Glob(pattern)
+	// Загружаем снимок предыдущего уровня инкрементального архива
+	if opts.listedIncremental != "" {
+		prev, err := loadSnapshot(opts.listedIncremental)
 		if err != nil {
-			// Если не шаблон, то используем как есть
-			matches = []string{pattern}
+			return err
 		}
-
-		for _, filePath := range matches {
-			if err := addToArchive(tw, filePath, "", verbose, &addedCount, &totalSize); err != nil {
-				return fmt.Errorf("ошибка при добавлении %s: %v", filePath, err)
+		aw.incr = &incrementalState{prev: prev, next: newSnapshot(time.Now())}
+		if verbose {
+			if prev.time.IsZero() {
+				fmt.Fprintln(msg, "Инкрементальный архив: уровень 0")
+			} else {
+				fmt.Fprintf(msg, "Инкрементальный архив: изменения после %s\n", prev.time.Format("2006-01-02 15:04:05"))
 			}
 		}
 	}
 
-	if verbose {
-		fmt.Printf("\nАрхив создан: %s\n", filename)
-		fmt.Printf("Добавлено файлов: %d\n", addedCount)
-		fmt.Printf("Общий размер: %s\n", formatBytes(totalSize))
-	} else {
-		fmt.Printf("Архив создан: %s\n", filename)
+	if err := addFiles(aw, files); err != nil {
+		return err
 	}
 
-	return nil
-}
-
-func addToArchive(tw *tar.Writer, path, basePath string, verbose bool, count *int, totalSize *int64) error {
-	info, err := os.Lstat(path)
-	if err != nil {
+	// Записываем завершающие блоки tar и остаток сжатых данных
+	if err := tw.Close(); err != nil {
 		return err
 	}
+	if compressor != nil {
+		if err := compressor.Close(); err != nil {
+			return fmt.Errorf("ошибка сжатия gzip: %v", err)
+		}
+	}
+	if volumes != nil {
+		if err := volumes.Close(); err != nil {
+			return err
+		}
+		// Тома, оставшиеся от прежнего архива с тем же именем,
+		// иначе были бы прочитаны как продолжение нового
+		volumes.removeStale()
+	}
+	written = true
 
-	// Определяем имя в архиве
-	nameInArchive := path
-	if basePath != "" {
-		rel, err := filepath.Rel(basePath, path)
-		if err == nil {
-			nameInArchive = rel
+	// Сохраняем новый снимок только после успешной записи архива
+	if aw.incr != nil {
+		if err := aw.incr.next.save(opts.listedIncremental); err != nil {
+			return err
 		}
 	}
 
-	// Создаем header
-	var header *tar.Header
-	var linkTarget string
+	// Манифест строится по контрольным суммам, посчитанным при записи
+	if opts.manifest != "" {
+		if err := writeManifest(opts.manifest, aw.records); err != nil {
+			return err
+		}
+		if verbose {
+			fmt.Fprintf(msg, "Манифест записан: %s\n", opts.manifest)
+		}
+	}
 
-	if info.Mode()&os.ModeSymlink != 0 {
-		// Для символических ссылок получаем цель
-		linkTarget, err = os.Readlink(path)
-		if err != nil {
+	// Перечитываем архив и сравниваем его с исходными файлами
+	if opts.verify {
+		if err := verifyArchive(filename, opts.volumeSize > 0, aw.records, msg, verbose); err != nil {
 			return err
 		}
-		header, err = tar.FileInfoHeader(info, linkTarget)
+	}
+
+	if verbose {
+		fmt.Fprintf(msg, "\nАрхив создан: %s\n", filename)
+		fmt.Fprintf(msg, "Добавлено файлов: %d\n", aw.count)
+		if volumes != nil {
+			fmt.Fprintf(msg, "Томов: %d\n", volumes.index)
+		}
+		if aw.excluded > 0 {
+			fmt.Fprintf(msg, "Исключено: %d\n", aw.excluded)
+		}
+		fmt.Fprintf(msg, "Общий размер: %s\n", formatBytes(aw.totalSize))
 	} else {
-		header, err = tar.FileInfoHeader(info, "")
+		fmt.Fprintf(msg, "Архив создан: %s\n", filename)
 	}
-	
+
+	return nil
+}
+
+// appendArchive дописывает файлы в конец существующего несжатого архива.
+// В режиме update добавляются только файлы, более новые, чем их копии в архиве.
+func appendArchive(filename string, files []string, verbose, update bool, comp compression, opts createOptions) error {
+	if comp != compressNone {
+		return fmt.Errorf("дописывание в сжатый архив не поддерживается (%s)", comp)
+	}
+	if filename == stdioName {
+		return fmt.Errorf("дописывание невозможно при работе со стандартным потоком")
+	}
+
+	// Открываем архив для чтения и записи, при отсутствии создаем
+	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("не удалось открыть архив %s: %v", filename, err)
+	}
+	defer file.Close()
+
+	// Проверяем, что архив не сжат
+	detected, err := detectCompression(bufio.NewReader(file))
+	if err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	if detected != compressNone {
+		return fmt.Errorf("архив %s сжат (%s): дописывание возможно только в несжатый архив", filename, detected)
+	}
+
+	// Ищем конец последнего члена архива
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	end, members, err := scanArchive(file)
 	if err != nil {
 		return err
 	}
+	if _, err := file.Seek(end, io.SeekStart); err != nil {
+		return err
+	}
 
-	// Используем относительный путь в архиве
-	header.Name = nameInArchive
+	tw := tar.NewWriter(file)
 
-	// Записываем header
-	if err := tw.WriteHeader(header); err != nil {
+	if verbose {
+		fmt.Printf("Дописывание в архив: %s\n", filename)
+		fmt.Println("Добавляемые файлы:")
+	}
+
+	aw := &archiveWriter{tw: tw, verbose: verbose, opts: opts, log: os.Stdout}
+	if update {
+		aw.existing = members
+	}
+	if err := addFiles(aw, files); err != nil {
+		return err
+	}
+
+	// Записываем завершающие блоки и отрезаем остаток старого архива
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	pos, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if err := file.Truncate(pos); err != nil {
 		return err
 	}
 
-	// Выводим информацию если нужно
 	if verbose {
-		modeStr := info.Mode().String()
-		size := info.Size()
-		if info.IsDir() {
-			size = 0
+		fmt.Printf("\nАрхив дополнен: %s\n", filename)
+		fmt.Printf("Добавлено файлов: %d\n", aw.count)
+		if aw.excluded > 0 {
+			fmt.Printf("Исключено: %d\n", aw.excluded)
 		}
-		timeStr := info.ModTime().Format("2006-01-02 15:04")
-		
-		fmt.Printf("%10s %8d %s %s\n", modeStr, size, timeStr, nameInArchive)
+		fmt.Printf("Общий размер: %s\n", formatBytes(aw.totalSize))
+	} else {
+		fmt.Printf("Архив дополнен: %s\n", filename)
 	}
 
-	// Если это не обычный файл, не пишем данные
-	if !info.Mode().IsRegular() {
-		if info.IsDir() {
-			// Рекурсивно обрабатываем содержимое директории
-			dir, err := os.Open(path)
-			if err != nil {
-				return err
-			}
-			defer dir.Close()
+	return nil
+}
+
+// countingReader подсчитывает количество прочитанных байт
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// scanArchive находит смещение конца последнего члена архива (перед
+// завершающими нулевыми блоками) и собирает время модификации членов
+func scanArchive(r io.Reader) (int64, map[string]time.Time, error) {
+	cr := &countingReader{r: r}
+	tr := tar.NewReader(cr)
+	members := make(map[string]time.Time)
+	var end int64
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, nil, fmt.Errorf("ошибка чтения архива: %v", err)
+		}
+
+		// Дочитываем данные члена и выравниваем по границе блока
+		if _, err := io.Copy(io.Discard, tr); err != nil {
+			return 0, nil, fmt.Errorf("ошибка чтения архива: %v", err)
+		}
+		end = (cr.n + blockSize - 1) / blockSize * blockSize
+
+		// Запоминаем самую новую копию каждого члена
+		key := memberKey(header.Name)
+		if prev, ok := members[key]; !ok || header.ModTime.After(prev) {
+			members[key] = header.ModTime
+		}
+	}
+
+	return end, members, nil
+}
+
+// memberKey приводит имя члена архива к единому виду для сравнения
+func memberKey(name string) string {
+	return filepath.Clean(filepath.FromSlash(name))
+}
+
+// blockSize — размер блока tar
+const blockSize = 512
+
+// archiveWriter хранит состояние записи архива
+type archiveWriter struct {
+	tw        *tar.Writer
+	verbose   bool
+	opts      createOptions
+	log       io.Writer // куда выводить подробную информацию
+	count     int
+	excluded  int
+	totalSize int64
+
+	// Для режима -u: время модификации членов, уже находящихся в архиве
+	existing map[string]time.Time
+
+	// Для режима --listed-incremental: предыдущий и новый снимки
+	incr *incrementalState
+
+	// Уже записанные файлы с несколькими жесткими ссылками
+	hardlinks map[fileID]string
+
+	// Записанные обычные файлы и их контрольные суммы (для -W и --manifest)
+	records []archivedFile
+	sums    map[string][]byte
+}
+
+// archivedFile — обычный файл, записанный в архив
+type archivedFile struct {
+	name   string
+	source string
+	size   int64
+	sum    []byte
+}
+
+// needSums сообщает, нужно ли считать контрольные суммы при записи
+func (aw *archiveWriter) needSums() bool {
+	return aw.opts.verify || aw.opts.manifest != ""
+}
+
+// addRecord запоминает записанный файл; жесткая ссылка получает
+// контрольную сумму своей цели
+func (aw *archiveWriter) addRecord(name, source string, size int64, sum []byte) {
+	if aw.sums == nil {
+		aw.sums = make(map[string][]byte)
+	}
+	aw.sums[name] = sum
+	aw.records = append(aw.records, archivedFile{name: name, source: source, size: size, sum: sum})
+}
+
+// fileID однозначно определяет файл: устройство и номер inode
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// hardlinkTarget возвращает имя, под которым этот же inode уже записан
+// в архив. Первое вхождение файла запоминается и записывается с данными.
+func (aw *archiveWriter) hardlinkTarget(info os.FileInfo, nameInArchive string) (string, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink < 2 {
+		return "", false
+	}
+	id := fileID{dev: uint64(st.Dev), ino: st.Ino}
+	if first, ok := aw.hardlinks[id]; ok {
+		return first, true
+	}
+	if aw.hardlinks == nil {
+		aw.hardlinks = make(map[fileID]string)
+	}
+	aw.hardlinks[id] = nameInArchive
+	return "", false
+}
+
+// addFiles разворачивает шаблоны и добавляет найденные файлы в архив
+func addFiles(aw *archiveWriter, files []string) error {
+	for _, pattern := range files {
+		// Разворачиваем шаблоны
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			// Если не шаблон, то используем как есть
+			matches = []string{pattern}
+		}
+
+		for _, filePath := range matches {
+			// В инкрементальном режиме неизмененные файлы пропускаются;
+			// директории проверяются по содержимому
+			if aw.incr != nil {
+				if info, err := os.Lstat(filePath); err == nil && !info.IsDir() && !aw.incr.changed(info) {
+					continue
+				}
+			}
+			if err := addToArchive(aw, filePath, ""); err != nil {
+				return fmt.Errorf("ошибка при добавлении %s: %v", filePath, err)
+			}
+		}
+	}
+	return nil
+}
+
+// isUpToDate сообщает, что в архиве уже есть копия файла не старше его самого
+func (aw *archiveWriter) isUpToDate(name string, info os.FileInfo) bool {
+	if aw.existing == nil {
+		return false
+	}
+	archived, ok := aw.existing[memberKey(name)]
+	if !ok {
+		return false
+	}
+	return !info.ModTime().Truncate(time.Second).After(archived)
+}
+
+// isExcluded проверяет путь по шаблонам исключения: шаблон сравнивается
+// и с полным путем, и с именем файла
+func (aw *archiveWriter) isExcluded(path string) bool {
+	cleaned := filepath.Clean(path)
+	base := filepath.Base(cleaned)
+	for _, pattern := range aw.opts.exclude {
+		pattern = filepath.Clean(pattern)
+		if m, _ := filepath.Match(pattern, cleaned); m {
+			return true
+		}
+		if m, _ := filepath.Match(pattern, base); m {
+			return true
+		}
+	}
+	return false
+}
+
+// skipExcluded проверяет путь по шаблонам исключения и учитывает
+// исключенные файлы в статистике
+func (aw *archiveWriter) skipExcluded(path string) bool {
+	if !aw.isExcluded(path) {
+		return false
+	}
+	aw.excluded++
+	if aw.verbose {
+		fmt.Fprintf(aw.log, "Исключен: %s\n", path)
+	}
+	return true
+}
+
+// printAdded выводит строку о добавленном члене архива
+func (aw *archiveWriter) printAdded(info os.FileInfo, nameInArchive string) {
+	modeStr := info.Mode().String()
+	size := info.Size()
+	if info.IsDir() {
+		size = 0
+	}
+	timeStr := info.ModTime().Format("2006-01-02 15:04")
+
+	fmt.Fprintf(aw.log, "%10s %8d %s %s\n", modeStr, size, timeStr, nameInArchive)
+}
+
+func addToArchive(aw *archiveWriter, path, basePath string) error {
+	// Исключенные файлы и директории не обходятся вовсе
+	if aw.skipExcluded(path) {
+		return nil
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	// Определяем имя в архиве
+	nameInArchive := path
+	if basePath != "" {
+		rel, err := filepath.Rel(basePath, path)
+		if err == nil {
+			nameInArchive = rel
+		}
+	}
+
+	// Создаем header
+	var header *tar.Header
+	var linkTarget string
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		// Для символических ссылок получаем цель
+		linkTarget, err = os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		header, err = tar.FileInfoHeader(info, linkTarget)
+	} else {
+		header, err = tar.FileInfoHeader(info, "")
+	}
+	
+	if err != nil {
+		return err
+	}
+
+	// Используем относительный путь в архиве
+	header.Name = nameInArchive
+
+	// Время модификации отбрасываем до секунд, как GNU tar:
+	// tar.Writer иначе округлил бы его до ближайшей секунды.
+	// Время доступа и изменения inode не сохраняем: они различаются
+	// между сборками и делают архивы невоспроизводимыми
+	header.ModTime = header.ModTime.Truncate(time.Second)
+	header.AccessTime = time.Time{}
+	header.ChangeTime = time.Time{}
+	aw.opts.applyOverrides(header)
+
+	// Сохраняем расширенные атрибуты в записях PAX
+	if aw.opts.xattrs && info.Mode()&os.ModeSymlink == 0 {
+		attrs, err := readXattrs(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Предупреждение: %s: не удалось прочитать расширенные атрибуты: %v\n", path, err)
+		}
+		for name, value := range attrs {
+			if header.PAXRecords == nil {
+				header.PAXRecords = make(map[string]string)
+			}
+			header.PAXRecords[xattrPAXPrefix+name] = value
+		}
+	}
+
+	// В режиме -u пропускаем файлы, которые не изменились;
+	// содержимое директорий при этом все равно проверяется
+	if aw.isUpToDate(nameInArchive, info) {
+		if info.IsDir() {
+			return addDirContents(aw, path, basePath)
+		}
+		return nil
+	}
+
+	// В инкрементальном режиме директория записывается вместе
+	// со списком своего содержимого
+	if info.IsDir() && aw.incr != nil {
+		return addDumpDir(aw, path, basePath, info, header)
+	}
+
+	// Повторные жесткие ссылки на уже записанный файл сохраняются
+	// как ссылки, без повторного копирования данных
+	if info.Mode().IsRegular() {
+		if first, ok := aw.hardlinkTarget(info, nameInArchive); ok {
+			header.Typeflag = tar.TypeLink
+			header.Linkname = first
+			header.Size = 0
+		}
+	}
+
+	// Записываем header
+	if err := aw.tw.WriteHeader(header); err != nil {
+		return err
+	}
+
+	// Выводим информацию если нужно
+	if aw.verbose {
+		if header.Typeflag == tar.TypeLink {
+			fmt.Fprintf(aw.log, "%10s %8d %s %s -> %s\n", info.Mode().String(), 0,
+				info.ModTime().Format("2006-01-02 15:04"), nameInArchive, header.Linkname)
+		} else {
+			aw.printAdded(info, nameInArchive)
+		}
+	}
+
+	// У жесткой ссылки нет данных
+	if header.Typeflag == tar.TypeLink {
+		if aw.needSums() {
+			aw.addRecord(nameInArchive, path, info.Size(), aw.sums[header.Linkname])
+		}
+		aw.count++
+		return nil
+	}
+
+	// Если это не обычный файл, не пишем данные
+	if !info.Mode().IsRegular() {
+		if info.IsDir() {
+			// Рекурсивно обрабатываем содержимое директории
+			if err := addDirContents(aw, path, basePath); err != nil {
+				return err
+			}
+		}
+		aw.count++
+		return nil
+	}
+
+	// Открываем файл для чтения
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Копируем содержимое, при необходимости считая SHA-256
+	var dst io.Writer = aw.tw
+	hasher := sha256.New()
+	if aw.needSums() {
+		dst = io.MultiWriter(aw.tw, hasher)
+	}
+	written, err := io.Copy(dst, file)
+	if err != nil {
+		return err
+	}
+	if aw.needSums() {
+		aw.addRecord(nameInArchive, path, written, hasher.Sum(nil))
+	}
+
+	aw.totalSize += written
+	aw.count++
+	return nil
+}
+
+// writeManifest записывает контрольные суммы в формате sha256sum
+func writeManifest(path string, records []archivedFile) error {
+	var buf bytes.Buffer
+	for _, rec := range records {
+		// sha256sum экранирует имена с переводом строки или обратной чертой
+		name := rec.name
+		prefix := ""
+		if strings.ContainsAny(name, "\\\n") {
+			prefix = "\\"
+			name = strings.ReplaceAll(name, "\\", "\\\\")
+			name = strings.ReplaceAll(name, "\n", "\\n")
+		}
+		fmt.Fprintf(&buf, "%s%x  %s\n", prefix, rec.sum, name)
+	}
+
+	if path == stdioName {
+		_, err := os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("не удалось записать манифест %s: %v", path, err)
+	}
+	return nil
+}
+
+// verifyArchive перечитывает записанный архив и сравнивает размер и
+// SHA-256 каждого обычного файла с исходным файлом на диске
+func verifyArchive(filename string, multiVolume bool, records []archivedFile, msg io.Writer, verbose bool) error {
+	archive, err := openArchiveReader(filename, compressNone, multiVolume)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	if verbose {
+		fmt.Fprintf(msg, "Проверка архива: %s\n", filename)
+	}
+
+	expected := make(map[string]archivedFile, len(records))
+	for _, rec := range records {
+		expected[rec.name] = rec
+	}
+	seen := make(map[string]bool, len(records))
+	problems := 0
+	report := func(name, problem string) {
+		problems++
+		fmt.Fprintf(msg, "%s: %s\n", name, problem)
+	}
+
+	tr := tar.NewReader(archive)
+	err = forEachMember(tr, newMemberFilter(nil), func(header *tar.Header) error {
+		rec, ok := expected[header.Name]
+		if !ok {
+			return nil
+		}
+		seen[header.Name] = true
+
+		// Данные в архиве: у жесткой ссылки они хранятся в цели
+		archived := rec.sum
+		archivedSize := rec.size
+		if header.Typeflag != tar.TypeLink {
+			hasher := sha256.New()
+			n, err := io.Copy(hasher, tr)
+			if err != nil {
+				return fmt.Errorf("ошибка чтения архива: %v", err)
+			}
+			archived = hasher.Sum(nil)
+			archivedSize = n
+		}
+
+		// Исходный файл на диске
+		sourceSum, sourceSize, err := fileSHA256(rec.source)
+		if err != nil {
+			report(header.Name, fmt.Sprintf("не удалось прочитать исходный файл: %v", err))
+			return nil
+		}
+		switch {
+		case archivedSize != sourceSize:
+			report(header.Name, fmt.Sprintf("различается размер (%d в архиве, %d на диске)", archivedSize, sourceSize))
+		case !bytes.Equal(archived, sourceSum):
+			report(header.Name, "различается контрольная сумма SHA-256")
+		case verbose:
+			fmt.Fprintf(msg, "%s: OK\n", header.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, rec := range records {
+		if !seen[rec.name] {
+			report(rec.name, "отсутствует в архиве")
+		}
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("проверка архива не пройдена: ошибок %d", problems)
+	}
+	if verbose {
+		fmt.Fprintf(msg, "Проверено файлов: %d\n", len(records))
+	}
+	return nil
+}
+
+// fileSHA256 считает SHA-256 и размер файла
+func fileSHA256(path string) ([]byte, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	n, err := io.Copy(hasher, file)
+	if err != nil {
+		return nil, 0, err
+	}
+	return hasher.Sum(nil), n, nil
+}
+
+// addDirContents добавляет в архив содержимое директории
+func addDirContents(aw *archiveWriter, path, basePath string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	entries, err := dir.Readdir(0)
+	if err != nil {
+		return err
+	}
+
+	// Порядок файловой системы зависит от истории директории
+	if aw.opts.sortByName {
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].Name() < entries[j].Name()
+		})
+	}
+
+	for _, entry := range entries {
+		fullPath := filepath.Join(path, entry.Name())
+		if err := addToArchive(aw, fullPath, basePath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractOptions — параметры извлечения архива
+type extractOptions struct {
+	destDir         string
+	stripComponents int
+	filter          *memberFilter
+	preservePerms   bool
+	sameOwner       bool
+	xattrs          bool
+	unsafePaths     bool
+	incremental     bool
+	multiVolume     bool
+}
+
+func extractArchive(filename string, verbose bool, comp compression, opts extractOptions) error {
+	// Проверяем целевую директорию
+	if opts.destDir == "" {
+		opts.destDir = "."
+	}
+	if info, err := os.Stat(opts.destDir); err != nil {
+		return fmt.Errorf("не удалось перейти в директорию %s: %v", opts.destDir, err)
+	} else if !info.IsDir() {
+		return fmt.Errorf("%s не является директорией", opts.destDir)
+	}
+	root, err := newExtractRoot(opts.destDir, opts.unsafePaths)
+	if err != nil {
+		return err
+	}
+
+	// Открываем архив, формат сжатия определяется автоматически
+	archive, err := openArchiveReader(filename, comp, opts.multiVolume)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	if verbose && archive.comp != compressNone {
+		fmt.Printf("Используется распаковка %s\n", archive.comp)
+	}
+
+	tr := tar.NewReader(archive)
+
+	if verbose {
+		fmt.Printf("Извлечение архива: %s\n", filename)
+	}
+
+	extractedCount := 0
+	totalSize := int64(0)
+
+	// Метаданные директорий восстанавливаются после их содержимого,
+	// иначе запись файлов изменит время модификации директории
+	var dirs []*tar.Header
+
+	// Извлекаем файлы
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("ошибка чтения архива: %v", err)
+		}
+
+		// Отбираем только запрошенные члены архива
+		if !opts.filter.match(header.Name) {
+			continue
+		}
+
+		// Удаляем начальные элементы пути
+		name, ok := stripPath(header.Name, opts.stripComponents)
+		if !ok {
+			continue
+		}
+		stripped := *header
+		stripped.Name = name
+		if header.Typeflag == tar.TypeLink {
+			// Цель жесткой ссылки тоже находится внутри архива
+			if stripped.Linkname, ok = stripPath(header.Linkname, opts.stripComponents); !ok {
+				return fmt.Errorf("ошибка при извлечении %s: цель ссылки %s удалена --strip-components", header.Name, header.Linkname)
+			}
+		}
+
+		// Извлекаем файл
+		size, err := extractFile(tr, &stripped, root, &opts, verbose)
+		if err != nil {
+			return fmt.Errorf("ошибка при извлечении %s: %v", header.Name, err)
+		}
+		if stripped.Typeflag == tar.TypeDir || stripped.Typeflag == typeGNUDumpDir {
+			dirs = append(dirs, &stripped)
+		}
+		if stripped.Typeflag == tar.TypeSymlink {
+			root.addSymlink(stripped.Name)
+		}
+
+		extractedCount++
+		totalSize += size
+	}
+
+	// Восстанавливаем метаданные директорий, начиная с вложенных
+	for i := len(dirs) - 1; i >= 0; i-- {
+		target, err := root.resolve(dirs[i].Name, true)
+		if err != nil {
+			return fmt.Errorf("ошибка при извлечении %s: %v", dirs[i].Name, err)
+		}
+		restoreMetadata(target, dirs[i], &opts)
+	}
+
+	if verbose {
+		fmt.Printf("\nАрхив извлечен: %s\n", filename)
+		fmt.Printf("Извлечено файлов: %d\n", extractedCount)
+		fmt.Printf("Общий размер: %s\n", formatBytes(totalSize))
+	} else {
+		fmt.Printf("Архив извлечен: %s\n", filename)
+	}
+
+	return opts.filter.err()
+}
+
+func extractFile(tr *tar.Reader, header *tar.Header, root *extractRoot, opts *extractOptions, verbose bool) (int64, error) {
+	// Путь на диске относительно целевой директории; проверяется
+	// каждый его компонент, включая уже существующие ссылки
+	isDir := header.Typeflag == tar.TypeDir || header.Typeflag == typeGNUDumpDir
+	target, err := root.resolve(header.Name, isDir)
+	if err != nil {
+		return 0, err
+	}
+
+	// Существующая символическая ссылка заменяется, а не используется
+	// для записи: иначе данные попадут туда, куда она указывает.
+	// Ссылки создаются заново и при повторном извлечении
+	if !isDir {
+		if fi, err := os.Lstat(target); err == nil && !fi.IsDir() {
+			isLink := header.Typeflag == tar.TypeLink || header.Typeflag == tar.TypeSymlink
+			if isLink || (fi.Mode()&os.ModeSymlink != 0 && !root.unsafe) {
+				if err := os.Remove(target); err != nil {
+					return 0, err
+				}
+			}
+		}
+	}
+
+	// Создаем все родительские директории
+	dir := filepath.Dir(target)
+	if dir != "." && dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return 0, err
+		}
+	}
+
+	var size int64
+
+	// Обрабатываем в зависимости от типа файла
+	switch header.Typeflag {
+	case tar.TypeDir:
+		// Создаем директорию, метаданные восстанавливаются позже
+		if err := os.MkdirAll(target, os.FileMode(header.Mode)); err != nil {
+			return 0, err
+		}
+		if verbose {
+			fmt.Printf("Создана директория: %s/\n", header.Name)
+		}
+		// Список содержимого инкрементального архива в формате posix
+		if contents, ok := header.PAXRecords[dumpDirPAXKey]; ok && opts.incremental {
+			if err := removeMissing(target, header.Name, parseDumpDir([]byte(contents)), verbose); err != nil {
+				return 0, err
+			}
+		}
+		return 0, nil
+
+	case typeGNUDumpDir:
+		// Директория инкрементального архива
+		if err := os.MkdirAll(target, os.FileMode(header.Mode)); err != nil {
+			return 0, err
+		}
+		if verbose {
+			fmt.Printf("Создана директория: %s/\n", header.Name)
+		}
+		// Удаляем файлы, которых не было на момент создания архива
+		if opts.incremental {
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return 0, err
+			}
+			if err := removeMissing(target, header.Name, parseDumpDir(data), verbose); err != nil {
+				return 0, err
+			}
+		}
+		return 0, nil
+
+	case tar.TypeReg, tar.TypeRegA:
+		// Создаем обычный файл
+		file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode))
+		if err != nil {
+			return 0, err
+		}
+
+		// Копируем содержимое
+		written, err := io.Copy(file, tr)
+		file.Close()
+		if err != nil {
+			return 0, err
+		}
+		size = written
+
+		if verbose {
+			fmt.Printf("Извлечен файл: %s (%s)\n", header.Name, formatBytes(size))
+		}
+
+	case tar.TypeSymlink:
+		// Создаем символическую ссылку
+		if err := os.Symlink(header.Linkname, target); err != nil {
+			return 0, err
+		}
+		if verbose {
+			fmt.Printf("Создана ссылка: %s -> %s\n", header.Name, header.Linkname)
+		}
+
+	case tar.TypeLink:
+		// Создаем жесткую ссылку, цель тоже берется из целевой директории
+		linkTarget, err := root.resolve(header.Linkname, false)
+		if err != nil {
+			return 0, fmt.Errorf("цель ссылки: %v", err)
+		}
+		if err := os.Link(linkTarget, target); err != nil {
+			return 0, err
+		}
+		if verbose {
+			fmt.Printf("Создана жесткая ссылка: %s -> %s\n", header.Name, header.Linkname)
+		}
+		// Метаданные общие с целью ссылки
+		return 0, nil
+
+	case tar.TypeChar, tar.TypeBlock:
+		// Создаем файл устройства (требуются права администратора)
+		mode := uint32(header.Mode & 07777)
+		if header.Typeflag == tar.TypeChar {
+			mode |= syscall.S_IFCHR
+		} else {
+			mode |= syscall.S_IFBLK
+		}
+		dev := mkdev(header.Devmajor, header.Devminor)
+		if err := syscall.Mknod(target, mode, dev); err != nil {
+			if err == syscall.EPERM {
+				fmt.Fprintf(os.Stderr, "Предупреждение: %s: недостаточно прав для создания устройства\n", header.Name)
+				return 0, nil
+			}
+			return 0, err
+		}
+		if verbose {
+			fmt.Printf("Создано устройство: %s (%d, %d)\n", header.Name, header.Devmajor, header.Devminor)
+		}
+
+	case tar.TypeFifo:
+		// Создаем именованный канал
+		if err := syscall.Mkfifo(target, uint32(header.Mode&07777)); err != nil {
+			return 0, err
+		}
+		if verbose {
+			fmt.Printf("Создан канал: %s\n", header.Name)
+		}
+
+	default:
+		if verbose {
+			fmt.Printf("Пропущен: %s (тип: %c)\n", header.Name, header.Typeflag)
+		}
+		return 0, nil
+	}
+
+	restoreMetadata(target, header, opts)
+
+	return size, nil
+}
+
+// mkdev кодирует номера устройства так же, как makedev(3) в Linux
+func mkdev(major, minor int64) int {
+	dev := (uint64(major) & 0xfffff000) << 32
+	dev |= (uint64(major) & 0x00000fff) << 8
+	dev |= (uint64(minor) & 0xffffff00) << 12
+	dev |= uint64(minor) & 0x000000ff
+	return int(dev)
+}
+
+// restoreMetadata восстанавливает расширенные атрибуты, владельца, права
+// доступа и время модификации. Ошибки не прерывают извлечение,
+// а выводятся как предупреждения.
+func restoreMetadata(target string, header *tar.Header, opts *extractOptions) {
+	isSymlink := header.Typeflag == tar.TypeSymlink
+
+	// Расширенные атрибуты восстанавливаются первыми: после смены
+	// владельца и прав запись может оказаться запрещена
+	if opts.xattrs && !isSymlink {
+		for key, value := range header.PAXRecords {
+			if !strings.HasPrefix(key, xattrPAXPrefix) {
+				continue
+			}
+			name := strings.TrimPrefix(key, xattrPAXPrefix)
+			if err := syscall.Setxattr(target, name, []byte(value), 0); err != nil {
+				fmt.Fprintf(os.Stderr, "Предупреждение: %s: не удалось установить атрибут %s: %v\n", header.Name, name, err)
+			}
+		}
+	}
+
+	// Владелец: сначала по имени, затем по числовому идентификатору
+	if opts.sameOwner {
+		uid, gid := resolveOwner(header)
+		if err := os.Lchown(target, uid, gid); err != nil {
+			fmt.Fprintf(os.Stderr, "Предупреждение: %s: не удалось сменить владельца: %v\n", header.Name, err)
+		}
+	}
+
+	// Точные права без учета umask, включая setuid, setgid и sticky.
+	// Устанавливаются после chown, так как chown сбрасывает setuid
+	if opts.preservePerms && !isSymlink {
+		if err := syscall.Chmod(target, uint32(header.Mode&07777)); err != nil {
+			fmt.Fprintf(os.Stderr, "Предупреждение: %s: не удалось установить права: %v\n", header.Name, err)
+		}
+	}
+
+	// Время доступа и модификации
+	if !header.ModTime.IsZero() {
+		atime := header.AccessTime
+		if atime.IsZero() {
+			atime = time.Now()
+		}
+		var err error
+		if isSymlink {
+			err = lutimes(target, atime, header.ModTime)
+		} else {
+			err = os.Chtimes(target, atime, header.ModTime)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Предупреждение: %s: не удалось установить время: %v\n", header.Name, err)
+		}
+	}
+}
+
+// resolveOwner определяет uid и gid для восстановления владельца.
+// Имена пользователя и группы имеют приоритет над числами из архива.
+func resolveOwner(header *tar.Header) (int, int) {
+	uid, gid := header.Uid, header.Gid
+	if header.Uname != "" {
+		if u, err := user.Lookup(header.Uname); err == nil {
+			if id, err := strconv.Atoi(u.Uid); err == nil {
+				uid = id
+			}
+		}
+	}
+	if header.Gname != "" {
+		if g, err := user.LookupGroup(header.Gname); err == nil {
+			if id, err := strconv.Atoi(g.Gid); err == nil {
+				gid = id
+			}
+		}
+	}
+	return uid, gid
+}
+
+// typeGNUDumpDir — тип члена GNU tar: директория со списком содержимого
+const typeGNUDumpDir = 'D'
+
+// dumpDirPAXKey — запись PAX со списком содержимого директории в
+// формате posix; значение то же, что данные члена GNU dumpdir
+const dumpDirPAXKey = "GNU.dumpdir"
+
+// snapshotDir — запись о директории в файле снимка
+type snapshotDir struct {
+	nfs      bool
+	mtime    time.Time
+	dev      uint64
+	ino      uint64
+	contents []string // имена с признаками Y, N или D, как в GNU dumpdir
+}
+
+// snapshot — файл снимка --listed-incremental в формате GNU tar версии 2
+type snapshot struct {
+	time time.Time
+	dirs map[string]*snapshotDir
+}
+
+// snapshotHeader — первая строка файла снимка
+const snapshotHeader = "GNU tar-1.35-2"
+
+func newSnapshot(t time.Time) *snapshot {
+	return &snapshot{time: t, dirs: make(map[string]*snapshotDir)}
+}
+
+// loadSnapshot читает файл снимка. Отсутствующий файл означает
+// архив уровня 0: в него попадают все файлы.
+func loadSnapshot(path string) (*snapshot, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return newSnapshot(time.Time{}), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать файл снимка %s: %v", path, err)
+	}
+	if len(data) == 0 {
+		return newSnapshot(time.Time{}), nil
+	}
+
+	bad := func(what string) error {
+		return fmt.Errorf("файл снимка %s поврежден: %s", path, what)
+	}
+
+	// Первая строка: версия формата
+	nl := bytes.IndexByte(data, '\n')
+	if nl < 0 || !strings.HasPrefix(string(data[:nl]), "GNU tar-") || !strings.HasSuffix(string(data[:nl]), "-2") {
+		return nil, fmt.Errorf("файл снимка %s: неподдерживаемый формат (нужна версия 2)", path)
+	}
+
+	// Остальные поля разделены нулевыми байтами
+	fields := strings.Split(string(data[nl+1:]), "\x00")
+	pos := 0
+	next := func() (string, bool) {
+		if pos >= len(fields) {
+			return "", false
+		}
+		pos++
+		return fields[pos-1], true
+	}
+	nextNum := func(what string) (uint64, error) {
+		field, ok := next()
+		if !ok {
+			return 0, bad("нет поля " + what)
+		}
+		n, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return 0, bad("неверное поле " + what)
+		}
+		return n, nil
+	}
+
+	sec, err := nextNum("времени")
+	if err != nil {
+		return nil, err
+	}
+	nsec, err := nextNum("времени")
+	if err != nil {
+		return nil, err
+	}
+	snap := newSnapshot(time.Unix(int64(sec), int64(nsec)))
+
+	for {
+		// Конец файла: остаются только пустые поля
+		if pos >= len(fields) || (fields[pos] == "" && pos == len(fields)-1) {
+			break
+		}
+
+		var nums [5]uint64
+		for i, what := range []string{"nfs", "mtime", "mtime", "dev", "ino"} {
+			if nums[i], err = nextNum(what); err != nil {
+				return nil, err
+			}
+		}
+		name, ok := next()
+		if !ok {
+			return nil, bad("нет имени директории")
+		}
+
+		dir := &snapshotDir{
+			nfs:   nums[0] != 0,
+			mtime: time.Unix(int64(nums[1]), int64(nums[2])),
+			dev:   nums[3],
+			ino:   nums[4],
+		}
+		// Содержимое директории заканчивается пустой строкой,
+		// за ней следует пустая строка конца записи
+		for {
+			entry, ok := next()
+			if !ok {
+				return nil, bad("незавершенная запись " + name)
+			}
+			if entry == "" {
+				break
+			}
+			dir.contents = append(dir.contents, entry)
+		}
+		next()
+
+		snap.dirs[name] = dir
+	}
+
+	return snap, nil
+}
+
+// save записывает снимок во временный файл и атомарно заменяет старый
+func (s *snapshot) save(path string) error {
+	var buf bytes.Buffer
+	buf.WriteString(snapshotHeader + "\n")
+	fmt.Fprintf(&buf, "%d\x00%d\x00", s.time.Unix(), s.time.Nanosecond())
+
+	names := make([]string, 0, len(s.dirs))
+	for name := range s.dirs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		dir := s.dirs[name]
+		nfs := 0
+		if dir.nfs {
+			nfs = 1
+		}
+		fmt.Fprintf(&buf, "%d\x00%d\x00%d\x00%d\x00%d\x00%s\x00",
+			nfs, dir.mtime.Unix(), dir.mtime.Nanosecond(), dir.dev, dir.ino, name)
+		for _, entry := range dir.contents {
+			buf.WriteString(entry + "\x00")
+		}
+		buf.WriteString("\x00\x00")
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("не удалось записать файл снимка %s: %v", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("не удалось записать файл снимка %s: %v", path, err)
+	}
+	return nil
+}
+
+// incrementalState — состояние создания инкрементального архива
+type incrementalState struct {
+	prev *snapshot
+	next *snapshot
+}
+
+// changed сообщает, изменился ли файл после предыдущего снимка.
+// Учитывается и ctime: он меняется при переименовании и смене прав.
+func (s *incrementalState) changed(info os.FileInfo) bool {
+	if s.prev.time.IsZero() || !info.ModTime().Before(s.prev.time) {
+		return true
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		ctime := time.Unix(st.Ctim.Sec, st.Ctim.Nsec)
+		return !ctime.Before(s.prev.time)
+	}
+	return false
+}
+
+// isNewDir сообщает, что директории не было в предыдущем снимке
+// или она была заменена (другое устройство или inode)
+func (s *incrementalState) isNewDir(path string, st *syscall.Stat_t) bool {
+	old, ok := s.prev.dirs[path]
+	if !ok {
+		return true
+	}
+	if st == nil {
+		return false
+	}
+	return old.ino != st.Ino || (!old.nfs && old.dev != st.Dev)
+}
+
+// addDumpDir записывает директорию как член GNU dumpdir: в данных
+// хранится список ее содержимого с признаками Y (файл в архиве),
+// N (файл не изменился) и D (поддиректория). По этому списку при
+// извлечении удаляются файлы, исчезнувшие после предыдущего уровня.
+func addDumpDir(aw *archiveWriter, path, basePath string, info os.FileInfo, header *tar.Header) error {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return err
+	}
+
+	st, _ := info.Sys().(*syscall.Stat_t)
+	newDir := aw.incr.isNewDir(path, st)
+
+	var contents []string
+	var toAdd []string
+	for _, entry := range entries {
+		fullPath := filepath.Join(path, entry.Name())
+		if aw.skipExcluded(fullPath) {
+			continue
+		}
+
+		entryInfo, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case entryInfo.IsDir():
+			contents = append(contents, "D"+entry.Name())
+			toAdd = append(toAdd, fullPath)
+		case newDir || aw.incr.changed(entryInfo):
+			contents = append(contents, "Y"+entry.Name())
+			toAdd = append(toAdd, fullPath)
+		default:
+			contents = append(contents, "N"+entry.Name())
+		}
+	}
+
+	// Данные члена: имена через нулевой байт и завершающий нулевой байт
+	var data bytes.Buffer
+	for _, entry := range contents {
+		data.WriteString(entry + "\x00")
+	}
+	data.WriteByte(0)
+
+	// Формат GNU не допускает записей PAX (например, --xattrs), поэтому
+	// в этом случае список пишется записью GNU.dumpdir обычной
+	// директории, как в формате posix у GNU tar
+	if len(header.PAXRecords) > 0 {
+		header.Typeflag = tar.TypeDir
+		header.PAXRecords[dumpDirPAXKey] = data.String()
+		if err := aw.tw.WriteHeader(header); err != nil {
+			return err
+		}
+	} else {
+		header.Typeflag = typeGNUDumpDir
+		header.Size = int64(data.Len())
+		header.Format = tar.FormatGNU
+		if err := aw.tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := aw.tw.Write(data.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	if aw.verbose {
+		aw.printAdded(info, header.Name)
+	}
+	aw.count++
+
+	// Запоминаем директорию в новом снимке
+	record := &snapshotDir{mtime: info.ModTime(), contents: contents}
+	if st != nil {
+		record.dev = st.Dev
+		record.ino = st.Ino
+	}
+	aw.incr.next.dirs[path] = record
+
+	for _, fullPath := range toAdd {
+		if err := addToArchive(aw, fullPath, basePath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseDumpDir разбирает данные члена GNU dumpdir в множество имен
+func parseDumpDir(data []byte) map[string]bool {
+	names := make(map[string]bool)
+	for _, entry := range strings.Split(string(data), "\x00") {
+		if len(entry) < 2 {
+			continue
+		}
+		name := entry[1:]
+		// Имена в списке не должны содержать путей
+		if strings.ContainsRune(name, '/') || name == "." || name == ".." {
+			continue
+		}
+		names[name] = true
+	}
+	return names
+}
+
+// removeMissing удаляет из директории файлы, которых нет в списке
+// GNU dumpdir: они были удалены после предыдущего уровня архива
+func removeMissing(target, name string, keep map[string]bool, verbose bool) error {
+	entries, err := os.ReadDir(target)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if keep[entry.Name()] {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(target, entry.Name())); err != nil {
+			return err
+		}
+		if verbose {
+			fmt.Printf("Удален: %s\n", filepath.Join(name, entry.Name()))
+		}
+	}
+	return nil
+}
+
+// Константы utimensat(2), которых нет в пакете syscall
+const (
+	atFDCWD           = -0x64
+	atSymlinkNoFollow = 0x100
+)
+
+// lutimes устанавливает время самой символической ссылки, а не ее цели
+func lutimes(path string, atime, mtime time.Time) error {
+	p, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return err
+	}
+	ts := [2]syscall.Timespec{
+		syscall.NsecToTimespec(atime.UnixNano()),
+		syscall.NsecToTimespec(mtime.UnixNano()),
+	}
+	dirfd := atFDCWD
+	_, _, errno := syscall.Syscall6(syscall.SYS_UTIMENSAT, uintptr(dirfd),
+		uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(&ts[0])),
+		atSymlinkNoFollow, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// xattrPAXPrefix — префикс записей PAX с расширенными атрибутами
+const xattrPAXPrefix = "SCHILY.xattr."
+
+// readXattrs читает расширенные атрибуты файла
+func readXattrs(path string) (map[string]string, error) {
+	size, err := syscall.Listxattr(path, nil)
+	if err != nil {
+		if err == syscall.ENOTSUP {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if size == 0 {
+		return nil, nil
+	}
+
+	buf := make([]byte, size)
+	size, err = syscall.Listxattr(path, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := make(map[string]string)
+	// Имена атрибутов разделены нулевыми байтами
+	for _, name := range strings.Split(string(buf[:size]), "\x00") {
+		if name == "" {
+			continue
+		}
+		vsize, err := syscall.Getxattr(path, name, nil)
+		if err != nil {
+			return attrs, err
+		}
+		value := make([]byte, vsize)
+		if vsize > 0 {
+			if vsize, err = syscall.Getxattr(path, name, value); err != nil {
+				return attrs, err
+			}
+		}
+		attrs[name] = string(value[:vsize])
+	}
+	return attrs, nil
+}
+
+// stripPath удаляет n начальных элементов пути. Если элементов не
+// осталось, возвращает false: такой член архива пропускается.
+func stripPath(name string, n int) (string, bool) {
+	if n == 0 {
+		return name, true
+	}
+	parts := strings.Split(strings.Trim(filepath.ToSlash(name), "/"), "/")
+	// Пропускаем элементы "." в начале, как это делает GNU tar
+	for len(parts) > 0 && parts[0] == "." {
+		parts = parts[1:]
+	}
+	if len(parts) <= n {
+		return "", false
+	}
+	return strings.Join(parts[n:], "/"), true
+}
+
+// memberFilter отбирает члены архива по именам и шаблонам из командной строки
+type memberFilter struct {
+	patterns []string
+	matched  []bool
+}
+
+func newMemberFilter(patterns []string) *memberFilter {
+	return &memberFilter{patterns: patterns, matched: make([]bool, len(patterns))}
+}
+
+// match проверяет, подходит ли член архива под один из шаблонов.
+// Без шаблонов подходят все члены. Имя директории выбирает и ее содержимое.
+func (f *memberFilter) match(name string) bool {
+	if len(f.patterns) == 0 {
+		return true
+	}
+	key := memberKey(name)
+	found := false
+	for i, pattern := range f.patterns {
+		p := memberKey(pattern)
+		ok := key == p || strings.HasPrefix(key, p+string(filepath.Separator))
+		if !ok {
+			ok, _ = filepath.Match(p, key)
+		}
+		if !ok {
+			// Шаблон может совпасть с родительской директорией
+			for dir := filepath.Dir(key); dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+				if m, _ := filepath.Match(p, dir); m {
+					ok = true
+					break
+				}
+			}
+		}
+		if ok {
+			f.matched[i] = true
+			found = true
+		}
+	}
+	return found
+}
+
+// err возвращает ошибку, если какие-то шаблоны не совпали ни с одним членом
+func (f *memberFilter) err() error {
+	var missing []string
+	for i, pattern := range f.patterns {
+		if !f.matched[i] {
+			missing = append(missing, pattern)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("не найдено в архиве: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// extractRoot ограничивает запись при извлечении целевой директорией
+type extractRoot struct {
+	dir     string
+	absDir  string
+	realDir string
+	unsafe  bool
+
+	// Символические ссылки, созданные при текущем извлечении
+	symlinks map[string]bool
+}
+
+func newExtractRoot(dir string, unsafe bool) (*extractRoot, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	realDir, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return nil, err
+	}
+	return &extractRoot{
+		dir:      dir,
+		absDir:   abs,
+		realDir:  realDir,
+		unsafe:   unsafe,
+		symlinks: make(map[string]bool),
+	}, nil
+}
+
+// addSymlink запоминает символическую ссылку, созданную из архива
+func (r *extractRoot) addSymlink(name string) {
+	r.symlinks[memberKey(name)] = true
+}
+
+// resolve возвращает путь на диске для члена архива. Каждый компонент
+// пути проверяется: запись через ссылку, созданную из архива, запрещена,
+// а уже существовавшие ссылки должны указывать внутрь целевой директории.
+// Последний компонент проверяется только для директорий: остальные
+// типы файлов заменяют существующую ссылку.
+func (r *extractRoot) resolve(name string, isDir bool) (string, error) {
+	if r.unsafe {
+		return filepath.Join(r.dir, name), nil
+	}
+
+	if !isSafePath(name) {
+		return "", fmt.Errorf("небезопасный путь: %s", name)
+	}
+
+	parts := strings.Split(memberKey(name), string(filepath.Separator))
+	check := len(parts) - 1
+	if isDir {
+		check = len(parts)
+	}
+
+	current := r.absDir
+	for i := 0; i < check; i++ {
+		if parts[i] == "." || parts[i] == "" {
+			continue
+		}
+		current = filepath.Join(current, parts[i])
+
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			// Дальше пути нет, он будет создан заново
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+
+		rel := filepath.Join(parts[:i+1]...)
+		if r.symlinks[rel] {
+			return "", fmt.Errorf("путь %s проходит через символическую ссылку %s из архива", name, rel)
+		}
+		resolved, err := filepath.EvalSymlinks(current)
+		if err != nil {
+			return "", fmt.Errorf("путь %s проходит через неразрешимую ссылку %s: %v", name, rel, err)
+		}
+		if !isWithin(r.realDir, resolved) {
+			return "", fmt.Errorf("путь %s выходит за пределы директории извлечения через ссылку %s", name, rel)
+		}
+	}
+
+	return filepath.Join(r.dir, name), nil
+}
+
+// isWithin проверяет, что путь path находится внутри директории root
+func isWithin(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func isSafePath(path string) bool {
+	// Проверяем, что путь не содержит опасных элементов
+	cleaned := filepath.Clean(path)
+	
+	// Запрещаем абсолютные пути и переходы наверх
+	if filepath.IsAbs(path) || strings.HasPrefix(cleaned, "..") {
+		return false
+	}
+	
+	// Проверяем каждый компонент пути
+	parts := strings.Split(cleaned, string(filepath.Separator))
+	for _, part := range parts {
+		if part == ".." {
+			return false
+		}
+	}
+	
+	return true
+}
+
+// Границы размера блока параллельного сжатия gzip
+const (
+	minGzipBlockSize = 32 * 1024
+	maxGzipBlockSize = 64 * 1024 * 1024
+)
+
+// gzipDictSize — размер окна deflate: столько последних байт предыдущего
+// блока используется как словарь для следующего
+const gzipDictSize = 32 * 1024
+
+// gzipBlock — блок данных, сжимаемый отдельным потоком
+type gzipBlock struct {
+	data []byte
+	dict []byte
+	out  []byte
+	err  error
+	done chan struct{}
+}
+
+// parallelGzipWriter сжимает данные блоками в нескольких потоках и
+// записывает их по порядку. Каждый блок сжимается с последними 32 КБ
+// предыдущего блока в качестве словаря и завершается синхронизирующим
+// сбросом deflate, поэтому результат — один обычный поток deflate,
+// а весь файл — стандартный gzip из одного члена.
+type parallelGzipWriter struct {
+	w         io.Writer
+	blockSize int
+	buf       []byte
+	dict      []byte
+	crc       uint32
+	size      uint32
+
+	workers chan struct{}   // ограничивает число одновременно сжимаемых блоков
+	queue   chan *gzipBlock // блоки в порядке записи
+	done    chan struct{}   // закрывается, когда записан последний блок
+
+	mu     sync.Mutex
+	err    error
+	closed bool
+}
+
+func newParallelGzipWriter(w io.Writer, threads, blockSize int) *parallelGzipWriter {
+	z := &parallelGzipWriter{
+		w:         w,
+		blockSize: blockSize,
+		buf:       make([]byte, 0, blockSize),
+		workers:   make(chan struct{}, threads),
+		queue:     make(chan *gzipBlock, threads*2),
+		done:      make(chan struct{}),
+	}
+
+	// Заголовок gzip: без имени файла и времени, ОС — Unix
+	header := []byte{0x1f, 0x8b, 8, 0, 0, 0, 0, 0, 0, 3}
+	if _, err := w.Write(header); err != nil {
+		z.err = err
+	}
+
+	go z.writeLoop()
+	return z
+}
+
+// writeLoop записывает сжатые блоки строго в порядке поступления
+func (z *parallelGzipWriter) writeLoop() {
+	defer close(z.done)
+	for block := range z.queue {
+		<-block.done
+		err := block.err
+		if err == nil && z.getErr() == nil {
+			_, err = z.w.Write(block.out)
+		}
+		if err != nil {
+			z.setErr(err)
+		}
+	}
+}
+
+func (z *parallelGzipWriter) getErr() error {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return z.err
+}
+
+func (z *parallelGzipWriter) setErr(err error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if z.err == nil {
+		z.err = err
+	}
+}
+
+func (z *parallelGzipWriter) Write(p []byte) (int, error) {
+	if err := z.getErr(); err != nil {
+		return 0, err
+	}
+
+	// Контрольная сумма и размер считаются по исходным данным
+	z.crc = crc32.Update(z.crc, crc32.IEEETable, p)
+	z.size += uint32(len(p))
+
+	written := 0
+	for len(p) > 0 {
+		n := copy(z.buf[len(z.buf):cap(z.buf)], p)
+		z.buf = z.buf[:len(z.buf)+n]
+		p = p[n:]
+		written += n
+		if len(z.buf) == cap(z.buf) {
+			z.submit()
+		}
+	}
+	return written, nil
+}
+
+// submit отправляет накопленный блок на сжатие
+func (z *parallelGzipWriter) submit() {
+	block := &gzipBlock{
+		data: z.buf,
+		dict: z.dict,
+		done: make(chan struct{}),
+	}
+
+	// Словарь для следующего блока — конец текущего (вместе с
+	// концом предыдущего, если текущий блок короче окна)
+	if len(z.buf) >= gzipDictSize {
+		z.dict = z.buf[len(z.buf)-gzipDictSize:]
+	} else {
+		dict := append(append([]byte{}, z.dict...), z.buf...)
+		if len(dict) > gzipDictSize {
+			dict = dict[len(dict)-gzipDictSize:]
+		}
+		z.dict = dict
+	}
+	z.buf = make([]byte, 0, z.blockSize)
+
+	z.workers <- struct{}{}
+	z.queue <- block
+	go func() {
+		defer func() { <-z.workers }()
+		block.out, block.err = compressBlock(block.data, block.dict)
+		close(block.done)
+	}()
+}
+
+// compressBlock сжимает блок и завершает его синхронизирующим сбросом
+func compressBlock(data, dict []byte) ([]byte, error) {
+	var out bytes.Buffer
+	fw, err := flate.NewWriterDict(&out, flate.DefaultCompression, dict)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := fw.Flush(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// Close сжимает остаток данных, дописывает последний блок deflate
+// и завершающие поля gzip (CRC-32 и размер)
+func (z *parallelGzipWriter) Close() error {
+	if z.closed {
+		return z.getErr()
+	}
+	z.closed = true
+
+	if len(z.buf) > 0 {
+		z.submit()
+	}
+	close(z.queue)
+	<-z.done
+
+	if err := z.getErr(); err != nil {
+		return err
+	}
+
+	// Пустой последний блок с признаком конца потока deflate
+	var final bytes.Buffer
+	fw, err := flate.NewWriter(&final, flate.DefaultCompression)
+	if err != nil {
+		return err
+	}
+	if err := fw.Close(); err != nil {
+		return err
+	}
+
+	trailer := make([]byte, 8)
+	binary.LittleEndian.PutUint32(trailer[0:4], z.crc)
+	binary.LittleEndian.PutUint32(trailer[4:8], z.size)
+
+	if _, err := z.w.Write(final.Bytes()); err != nil {
+		return err
+	}
+	_, err = z.w.Write(trailer)
+	return err
+}
+
+// parseSize разбирает размер с необязательным суффиксом K, M, G или T
+// (степени 1024), например 128K или 4G
+func parseSize(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, fmt.Errorf("пустой размер")
+	}
+
+	multiplier := int64(1)
+	switch strings.ToUpper(value[len(value)-1:]) {
+	case "K":
+		multiplier = 1 << 10
+	case "M":
+		multiplier = 1 << 20
+	case "G":
+		multiplier = 1 << 30
+	case "T":
+		multiplier = 1 << 40
+	}
+	if multiplier != 1 {
+		value = value[:len(value)-1]
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("неверный размер: %s", value)
+	}
+	if n > (1<<63-1)/multiplier {
+		return 0, fmt.Errorf("слишком большой размер: %s", value)
+	}
+	return n * multiplier, nil
+}
+
+// compression описывает формат сжатия архива
+type compression int
+
+const (
+	compressNone compression = iota
+	compressGzip
+	compressBzip2
+	compressLZW
+	compressZlib
+)
+
+func (c compression) String() string {
+	switch c {
+	case compressGzip:
+		return "gzip"
+	case compressBzip2:
+		return "bzip2"
+	case compressLZW:
+		return "compress (.Z)"
+	case compressZlib:
+		return "zlib"
+	default:
+		return "без сжатия"
+	}
+}
+
+// compressionFromFlags определяет формат сжатия по флагам -z, -j и -Z
+func compressionFromFlags(gzipFlag, bzip2Flag, lzwFlag bool) (compression, error) {
+	comp := compressNone
+	count := 0
+	if gzipFlag {
+		comp = compressGzip
+		count++
+	}
+	if bzip2Flag {
+		comp = compressBzip2
+		count++
+	}
+	if lzwFlag {
+		comp = compressLZW
+		count++
+	}
+	if count > 1 {
+		return compressNone, fmt.Errorf("можно указать только один формат сжатия: -z, -j или -Z")
+	}
+	return comp, nil
+}
+
+// unsupportedMagic — сигнатуры форматов, которые распознаются, но не поддерживаются
+var unsupportedMagic = []struct {
+	magic []byte
+	name  string
+}{
+	{[]byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, "xz"},
+	{[]byte{0x28, 0xb5, 0x2f, 0xfd}, "zstd"},
+	{[]byte("LZIP"), "lzip"},
+	{[]byte{0x04, 0x22, 0x4d, 0x18}, "lz4"},
+	{[]byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c}, "7z"},
+	{[]byte("PK\x03\x04"), "zip"},
+}
+
+// stdioName — имя архива, означающее стандартный ввод или вывод
+const stdioName = "-"
+
+// archiveReader — открытый архив с подключенной распаковкой
+type archiveReader struct {
+	io.Reader
+	comp    compression
+	closers []io.Closer
+}
+
+func (a *archiveReader) Close() error {
+	var firstErr error
+	// Закрываем в обратном порядке: сначала распаковщик, потом файл
+	for i := len(a.closers) - 1; i >= 0; i-- {
+		if err := a.closers[i].Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// openArchiveReader открывает архив и подключает распаковку по сигнатуре.
+// Если формат указан явно, он должен совпадать с обнаруженным.
+// Многотомный архив читается как один поток из всех томов по порядку.
+func openArchiveReader(filename string, requested compression, multiVolume bool) (*archiveReader, error) {
+	archive := &archiveReader{}
+
+	// "-" означает стандартный ввод, его не закрываем
+	var input io.Reader = os.Stdin
+	if multiVolume {
+		volumes := &volumeReader{base: filename}
+		if err := volumes.openNext(); err != nil {
+			return nil, err
+		}
+		archive.closers = append(archive.closers, volumes)
+		input = volumes
+	} else if filename != stdioName {
+		file, err := os.Open(filename)
+		if err != nil {
+			return nil, fmt.Errorf("не удалось открыть архив %s: %v", filename, err)
+		}
+		archive.closers = append(archive.closers, file)
+		input = file
+	}
+
+	br := bufio.NewReader(input)
+
+	detected, err := detectCompression(br)
+	if err != nil {
+		archive.Close()
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	if requested != compressNone && requested != detected {
+		archive.Close()
+		return nil, fmt.Errorf("%s: указано сжатие %s, но обнаружено: %s", filename, requested, detected)
+	}
+	archive.comp = detected
+
+	switch detected {
+	case compressGzip:
+		gzReader, err := gzip.NewReader(br)
+		if err != nil {
+			archive.Close()
+			return nil, fmt.Errorf("ошибка при распаковке gzip: %v", err)
+		}
+		archive.Reader = gzReader
+		archive.closers = append(archive.closers, gzReader)
+	case compressBzip2:
+		archive.Reader = bzip2.NewReader(br)
+	case compressZlib:
+		zReader, err := zlib.NewReader(br)
+		if err != nil {
+			archive.Close()
+			return nil, fmt.Errorf("ошибка при распаковке zlib: %v", err)
+		}
+		archive.Reader = zReader
+		archive.closers = append(archive.closers, zReader)
+	case compressLZW:
+		lzwReader, err := newLZWReader(br)
+		if err != nil {
+			archive.Close()
+			return nil, fmt.Errorf("ошибка при распаковке compress (.Z): %v", err)
+		}
+		archive.Reader = lzwReader
+	default:
+		archive.Reader = br
+	}
+
+	return archive, nil
+}
+
+// volumeName возвращает имя тома с номером n: первый том носит имя
+// архива, следующие — имя архива с суффиксом .2, .3 и т.д.
+func volumeName(base string, n int) string {
+	if n == 1 {
+		return base
+	}
+	return fmt.Sprintf("%s.%d", base, n)
+}
+
+// volumeWriter делит поток архива на тома не больше limit байт.
+// Член архива может начинаться в одном томе и продолжаться в следующем.
+type volumeWriter struct {
+	base    string
+	limit   int64
+	log     io.Writer // сообщения о новых томах, nil — без сообщений
+	index   int       // номер текущего тома
+	file    *os.File
+	written int64
+}
+
+func (v *volumeWriter) Write(p []byte) (int, error) {
+	total := 0
+	for len(p) > 0 {
+		// Следующий том открываем только когда есть что в него писать
+		if v.file == nil || v.written == v.limit {
+			if err := v.next(); err != nil {
+				return total, err
+			}
+		}
+
+		chunk := p
+		if room := v.limit - v.written; int64(len(chunk)) > room {
+			chunk = chunk[:room]
+		}
+		n, err := v.file.Write(chunk)
+		total += n
+		v.written += int64(n)
+		p = p[n:]
+		if err != nil {
+			return total, fmt.Errorf("ошибка записи тома %s: %v", v.file.Name(), err)
+		}
+	}
+	return total, nil
+}
+
+// next закрывает текущий том и создает следующий
+func (v *volumeWriter) next() error {
+	if err := v.Close(); err != nil {
+		return err
+	}
+	v.index++
+	name := volumeName(v.base, v.index)
+	file, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("не удалось создать том %s: %v", name, err)
+	}
+	v.file = file
+	v.written = 0
+	if v.log != nil {
+		fmt.Fprintf(v.log, "Том %d: %s\n", v.index, name)
+	}
+	return nil
+}
+
+func (v *volumeWriter) Close() error {
+	if v.file == nil {
+		return nil
+	}
+	err := v.file.Close()
+	v.file = nil
+	if err != nil {
+		return fmt.Errorf("ошибка записи тома %s: %v", volumeName(v.base, v.index), err)
+	}
+	return nil
+}
+
+// discard закрывает и удаляет все записанные тома
+func (v *volumeWriter) discard() {
+	v.Close()
+	for n := 1; n <= v.index; n++ {
+		os.Remove(volumeName(v.base, n))
+	}
+}
+
+// removeStale удаляет тома с номерами после последнего записанного
+func (v *volumeWriter) removeStale() {
+	for n := v.index + 1; ; n++ {
+		if err := os.Remove(volumeName(v.base, n)); err != nil {
+			return
+		}
+	}
+}
+
+// volumeReader читает тома архива подряд, пока не кончатся файлы томов
+type volumeReader struct {
+	base  string
+	index int
+	file  *os.File
+}
+
+// openNext открывает следующий том; отсутствие тома после первого
+// означает конец архива
+func (v *volumeReader) openNext() error {
+	name := volumeName(v.base, v.index+1)
+	file, err := os.Open(name)
+	if err != nil {
+		if v.index > 0 && os.IsNotExist(err) {
+			return io.EOF
+		}
+		return fmt.Errorf("не удалось открыть том %s: %v", name, err)
+	}
+	v.index++
+	v.file = file
+	return nil
+}
+
+func (v *volumeReader) Read(p []byte) (int, error) {
+	for {
+		if v.file == nil {
+			if err := v.openNext(); err != nil {
+				return 0, err
+			}
+		}
+		n, err := v.file.Read(p)
+		if err == io.EOF {
+			// Том закончился — продолжаем со следующего
+			v.file.Close()
+			v.file = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (v *volumeReader) Close() error {
+	if v.file == nil {
+		return nil
+	}
+	err := v.file.Close()
+	v.file = nil
+	return err
+}
+
+// detectCompression определяет формат сжатия по первым байтам потока
+func detectCompression(br *bufio.Reader) (compression, error) {
+	// Сначала проверяем, не является ли начало потока заголовком tar:
+	// имя файла может случайно совпасть с сигнатурой zlib
+	block, _ := br.Peek(512)
+	if len(block) == 512 && isTarHeader(block) {
+		return compressNone, nil
+	}
+
+	switch {
+	case bytes.HasPrefix(block, []byte{0x1f, 0x8b}):
+		return compressGzip, nil
+	case bytes.HasPrefix(block, []byte("BZh")):
+		return compressBzip2, nil
+	case bytes.HasPrefix(block, []byte{0x1f, 0x9d}):
+		return compressLZW, nil
+	case len(block) >= 2 && block[0]&0x0f == 8 && block[0]>>4 <= 7 &&
+		(uint16(block[0])<<8|uint16(block[1]))%31 == 0:
+		return compressZlib, nil
+	}
+
+	for _, u := range unsupportedMagic {
+		if bytes.HasPrefix(block, u.magic) {
+			return compressNone, fmt.Errorf("обнаружено сжатие %s, которое не поддерживается", u.name)
+		}
+	}
+
+	return compressNone, nil
+}
+
+// isTarHeader проверяет контрольную сумму блока заголовка tar.
+// Полностью нулевой блок (конец пустого архива) тоже считается tar.
+func isTarHeader(block []byte) bool {
+	var sum int64
+	allZero := true
+	for i, b := range block[:512] {
+		if b != 0 {
+			allZero = false
+		}
+		// Поле контрольной суммы при подсчете заменяется пробелами
+		if i >= 148 && i < 156 {
+			b = ' '
+		}
+		sum += int64(b)
+	}
+	if allZero {
+		return true
+	}
+
+	field := strings.TrimRight(strings.TrimLeft(string(block[148:156]), " \x00"), " \x00")
+	if field == "" {
+		return false
+	}
+	stored, err := strconv.ParseInt(field, 8, 64)
+	if err != nil {
+		return false
+	}
+	return stored == sum
+}
+
+// lzwReader распаковывает поток в формате утилиты compress (.Z).
+// Пакет compress/lzw несовместим с этим форматом: в нем иначе
+// устроены коды CLEAR/EOF и отсутствует выравнивание по группам кодов.
+type lzwReader struct {
+	br        *bufio.Reader
+	maxBits   uint
+	blockMode bool
+
+	// Состояние чтения кодов
+	nBits     uint
+	bitBuf    uint32
+	bitCount  uint
+	groupBits uint
+
+	// Словарь
+	prefix     []uint16
+	suffix     []byte
+	freeEnt    int
+	maxCode    int
+	maxMaxCode int
+	oldCode    int
+	finChar    byte
+
+	stack   []byte
+	pending []byte
+	err     error
+}
+
+const (
+	lzwInitBits = 9
+	lzwClear    = 256
+)
+
+func newLZWReader(br *bufio.Reader) (*lzwReader, error) {
+	header := make([]byte, 3)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("не удалось прочитать заголовок: %v", err)
+	}
+	if header[0] != 0x1f || header[1] != 0x9d {
+		return nil, fmt.Errorf("неверная сигнатура")
+	}
+
+	maxBits := uint(header[2] & 0x1f)
+	if maxBits < lzwInitBits || maxBits > 16 {
+		return nil, fmt.Errorf("неподдерживаемая разрядность кодов: %d", maxBits)
+	}
+
+	z := &lzwReader{
+		br:         br,
+		maxBits:    maxBits,
+		blockMode:  header[2]&0x80 != 0,
+		nBits:      lzwInitBits,
+		prefix:     make([]uint16, 1<<maxBits),
+		suffix:     make([]byte, 1<<maxBits),
+		maxCode:    1<<lzwInitBits - 1,
+		maxMaxCode: 1 << maxBits,
+		oldCode:    -1,
+	}
+	for i := 0; i < 256; i++ {
+		z.suffix[i] = byte(i)
+	}
+	z.freeEnt = 256
+	if z.blockMode {
+		z.freeEnt = 257
+	}
+	return z, nil
+}
+
+// readBits читает n бит, младшие биты идут первыми
+func (z *lzwReader) readBits(n uint) (int, error) {
+	for z.bitCount < n {
+		b, err := z.br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		z.bitBuf |= uint32(b) << z.bitCount
+		z.bitCount += 8
+	}
+	code := int(z.bitBuf & (1<<n - 1))
+	z.bitBuf >>= n
+	z.bitCount -= n
+	z.groupBits += n
+	return code, nil
+}
+
+// alignGroup пропускает остаток текущей группы кодов. compress пишет
+// коды группами по nBits байт и начинает новую группу при смене
+// разрядности или после кода CLEAR.
+func (z *lzwReader) alignGroup() error {
+	groupSize := z.nBits * 8
+	skip := (groupSize - z.groupBits%groupSize) % groupSize
+	for skip > 0 {
+		n := skip
+		if n > 8 {
+			n = 8
+		}
+		if _, err := z.readBits(n); err != nil {
+			return err
+		}
+		skip -= n
+	}
+	z.groupBits = 0
+	return nil
+}
+
+func (z *lzwReader) Read(p []byte) (int, error) {
+	for len(z.pending) == 0 {
+		if z.err != nil {
+			return 0, z.err
+		}
+		z.err = z.decode()
+	}
+	n := copy(p, z.pending)
+	z.pending = z.pending[n:]
+	return n, nil
+}
+
+// decode читает один код и помещает соответствующую строку в pending
+func (z *lzwReader) decode() error {
+	// Увеличиваем разрядность, когда словарь заполнил текущий диапазон
+	if z.freeEnt > z.maxCode {
+		if err := z.alignGroup(); err != nil {
+			return lzwEOF(err)
+		}
+		z.nBits++
+		if z.nBits == z.maxBits {
+			z.maxCode = z.maxMaxCode
+		} else {
+			z.maxCode = 1<<z.nBits - 1
+		}
+	}
+
+	code, err := z.readBits(z.nBits)
+	if err != nil {
+		return lzwEOF(err)
+	}
 
-			entries, err := dir.Readdir(0)
-			if err != nil {
-				return err
-			}
+	if z.oldCode == -1 {
+		if code >= 256 {
+			return fmt.Errorf("поврежденные данные compress (.Z)")
+		}
+		z.oldCode = code
+		z.finChar = byte(code)
+		z.pending = append(z.pending[:0], z.finChar)
+		return nil
+	}
 
-			for _, entry := range entries {
-				fullPath := filepath.Join(path, entry.Name())
-				if err := addToArchive(tw, fullPath, basePath, verbose, count, totalSize); err != nil {
-					return err
-				}
-			}
+	if code == lzwClear && z.blockMode {
+		// Сбрасываем словарь и начинаем новую группу кодов
+		if err := z.alignGroup(); err != nil {
+			return lzwEOF(err)
 		}
-		*count++
+		z.freeEnt = 256
+		z.nBits = lzwInitBits
+		z.maxCode = 1<<lzwInitBits - 1
 		return nil
 	}
 
-	// Открываем файл для чтения
-	file, err := os.Open(path)
-	if err != nil {
-		return err
+	inCode := code
+	z.stack = z.stack[:0]
+
+	// Особый случай: код еще не добавлен в словарь (KwKwK)
+	if code >= z.freeEnt {
+		if code > z.freeEnt {
+			return fmt.Errorf("поврежденные данные compress (.Z)")
+		}
+		z.stack = append(z.stack, z.finChar)
+		code = z.oldCode
 	}
-	defer file.Close()
 
-	// Копируем содержимое
-	written, err := io.Copy(tw, file)
-	if err != nil {
-		return err
+	// Разворачиваем строку в обратном порядке
+	for code >= 256 {
+		z.stack = append(z.stack, z.suffix[code])
+		code = int(z.prefix[code])
+	}
+	z.finChar = z.suffix[code]
+	z.stack = append(z.stack, z.finChar)
+
+	z.pending = z.pending[:0]
+	for i := len(z.stack) - 1; i >= 0; i-- {
+		z.pending = append(z.pending, z.stack[i])
 	}
 
-	*totalSize += written
-	*count++
+	// Добавляем новую запись в словарь
+	if z.freeEnt < z.maxMaxCode {
+		z.prefix[z.freeEnt] = uint16(z.oldCode)
+		z.suffix[z.freeEnt] = z.finChar
+		z.freeEnt++
+	}
+	z.oldCode = inCode
 	return nil
 }
 
-func extractArchive(filename string, verbose, gzipDecompress bool) error {
-	// Открываем архивный файл
-	file, err := os.Open(filename)
+// lzwEOF превращает неполный последний код в обычный конец потока
+func lzwEOF(err error) error {
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return io.EOF
+	}
+	return err
+}
+
+func listArchive(filename string, verbose bool, comp compression, multiVolume bool, format string, filter *memberFilter) error {
+	// Открываем архив, формат сжатия определяется автоматически
+	archive, err := openArchiveReader(filename, comp, multiVolume)
 	if err != nil {
-		return fmt.Errorf("не удалось открыть архив %s: %v", filename, err)
+		return err
 	}
-	defer file.Close()
+	defer archive.Close()
 
-	var reader io.Reader = file
+	tr := tar.NewReader(archive)
 
-	// Добавляем gzip декомпрессию если нужно
-	if gzipDecompress {
-		gzReader, err := gzip.NewReader(reader)
-		if err != nil {
-			return fmt.Errorf("ошибка при распаковке gzip: %v", err)
-		}
-		defer gzReader.Close()
-		reader = gzReader
-		if verbose {
-			fmt.Println("Используется распаковка gzip")
-		}
+	if format != listFormatText {
+		return writeListing(os.Stdout, tr, format, filter)
 	}
 
-	tr := tar.NewReader(reader)
+	fmt.Printf("Содержимое архива: %s\n", filename)
+	fmt.Println()
 
+	// Заголовок таблицы
 	if verbose {
-		fmt.Printf("Извлечение архива: %s\n", filename)
+		fmt.Println("Права      Владелец Группа    Размер     Дата                Имя")
+		fmt.Println("---------  -------  -------  ----------  ------------------  ----")
+	} else {
+		fmt.Println("Тип  Размер     Дата                Имя")
+		fmt.Println("---  ----------  ------------------  ----")
 	}
 
-	extractedCount := 0
+	totalFiles := 0
 	totalSize := int64(0)
 
-	// Извлекаем файлы
+	// Выводим информацию о файлах
+	err = forEachMember(tr, filter, func(header *tar.Header) error {
+		printFileInfo(header, verbose)
+
+		totalFiles++
+		if header.Typeflag == tar.TypeReg || header.Typeflag == tar.TypeRegA {
+			totalSize += header.Size
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println()
+	fmt.Printf("Всего файлов: %d\n", totalFiles)
+	fmt.Printf("Общий размер: %s\n", formatBytes(totalSize))
+
+	return filter.err()
+}
+
+// forEachMember вызывает fn для каждого члена архива, подходящего под
+// фильтр. Содержимое члена, не прочитанное fn, пропускается.
+func forEachMember(tr *tar.Reader, filter *memberFilter, fn func(header *tar.Header) error) error {
 	for {
 		header, err := tr.Next()
 		if err == io.EOF {
-			break
+			return nil
 		}
 		if err != nil {
 			return fmt.Errorf("ошибка чтения архива: %v", err)
 		}
 
-		// Извлекаем файл
-		size, err := extractFile(tr, header, verbose)
+		// Обрабатываем только запрошенные члены архива
+		if !filter.match(header.Name) {
+			continue
+		}
+
+		if err := fn(header); err != nil {
+			return err
+		}
+	}
+}
+
+// diffArchive сравнивает члены архива с файлами на диске и сообщает
+// о различиях. Если различия найдены, возвращает ошибку.
+func diffArchive(filename, dir string, verbose bool, comp compression, multiVolume bool, filter *memberFilter) error {
+	if dir == "" {
+		dir = "."
+	}
+
+	archive, err := openArchiveReader(filename, comp, multiVolume)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	tr := tar.NewReader(archive)
+
+	if verbose {
+		fmt.Printf("Сравнение архива: %s\n", filename)
+	}
+
+	checked := 0
+	differing := 0
+
+	err = forEachMember(tr, filter, func(header *tar.Header) error {
+		diffs, err := diffMember(tr, header, dir)
 		if err != nil {
-			return fmt.Errorf("ошибка при извлечении %s: %v", header.Name, err)
+			return fmt.Errorf("ошибка при сравнении %s: %v", header.Name, err)
 		}
 
-		extractedCount++
-		totalSize += size
+		checked++
+		if len(diffs) > 0 {
+			differing++
+			for _, d := range diffs {
+				fmt.Printf("%s: %s\n", header.Name, d)
+			}
+		} else if verbose {
+			fmt.Printf("%s: совпадает\n", header.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
 	if verbose {
-		fmt.Printf("\nАрхив извлечен: %s\n", filename)
-		fmt.Printf("Извлечено файлов: %d\n", extractedCount)
-		fmt.Printf("Общий размер: %s\n", formatBytes(totalSize))
-	} else {
-		fmt.Printf("Архив извлечен: %s\n", filename)
+		fmt.Printf("\nПроверено членов: %d\n", checked)
+		fmt.Printf("С различиями: %d\n", differing)
 	}
 
+	if err := filter.err(); err != nil {
+		return err
+	}
+	if differing > 0 {
+		return fmt.Errorf("найдены различия: %d из %d", differing, checked)
+	}
 	return nil
 }
 
-func extractFile(tr *tar.Reader, header *tar.Header, verbose bool) (int64, error) {
-	// Проверяем безопасность пути
-	if !isSafePath(header.Name) {
-		return 0, fmt.Errorf("небезопасный путь: %s", header.Name)
+// diffMember сравнивает один член архива с файлом на диске
+func diffMember(tr *tar.Reader, header *tar.Header, dir string) ([]string, error) {
+	path := filepath.Join(dir, header.Name)
+
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return []string{"отсутствует на диске"}, nil
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	// Создаем все родительские директории
-	dir := filepath.Dir(header.Name)
-	if dir != "." && dir != "" {
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			return 0, err
+	var diffs []string
+
+	// Тип файла
+	if !sameType(header, info) {
+		return []string{"различается тип файла"}, nil
+	}
+
+	// Жесткая ссылка должна указывать на тот же файл, что и ее цель
+	if header.Typeflag == tar.TypeLink {
+		targetInfo, err := os.Lstat(filepath.Join(dir, header.Linkname))
+		if err != nil || !os.SameFile(info, targetInfo) {
+			diffs = append(diffs, fmt.Sprintf("не является ссылкой на %s", header.Linkname))
 		}
+		return diffs, nil
 	}
 
-	var size int64
+	// Права доступа, владелец и время модификации
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		if int64(st.Mode&07777) != header.Mode&07777 {
+			diffs = append(diffs, fmt.Sprintf("различаются права доступа (%04o в архиве, %04o на диске)", header.Mode&07777, st.Mode&07777))
+		}
+		if int(st.Uid) != header.Uid {
+			diffs = append(diffs, fmt.Sprintf("различается владелец (%d в архиве, %d на диске)", header.Uid, st.Uid))
+		}
+		if int(st.Gid) != header.Gid {
+			diffs = append(diffs, fmt.Sprintf("различается группа (%d в архиве, %d на диске)", header.Gid, st.Gid))
+		}
+	}
+	if header.Typeflag != tar.TypeSymlink && info.ModTime().Unix() != header.ModTime.Unix() {
+		diffs = append(diffs, "различается время модификации")
+	}
 
-	// Обрабатываем в зависимости от типа файла
 	switch header.Typeflag {
-	case tar.TypeDir:
-		// Создаем директорию
-		if err := os.MkdirAll(header.Name, os.FileMode(header.Mode)); err != nil {
-			return 0, err
+	case tar.TypeSymlink:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return nil, err
 		}
-		if verbose {
-			fmt.Printf("Создана директория: %s/\n", header.Name)
+		if target != header.Linkname {
+			diffs = append(diffs, fmt.Sprintf("различается цель ссылки (%s в архиве, %s на диске)", header.Linkname, target))
 		}
 
 	case tar.TypeReg, tar.TypeRegA:
-		// Создаем обычный файл
-		file, err := os.OpenFile(header.Name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode))
-		if err != nil {
-			return 0, err
+		if info.Size() != header.Size {
+			diffs = append(diffs, fmt.Sprintf("различается размер (%d в архиве, %d на диске)", header.Size, info.Size()))
+			break
 		}
-		defer file.Close()
-
-		// Копируем содержимое
-		written, err := io.Copy(file, tr)
+		same, err := sameContent(tr, path)
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
-		size = written
-
-		if verbose {
-			fmt.Printf("Извлечен файл: %s (%s)\n", header.Name, formatBytes(size))
+		if !same {
+			diffs = append(diffs, "различается содержимое")
 		}
+	}
+
+	return diffs, nil
+}
 
+// sameType проверяет, что тип файла на диске совпадает с типом члена архива
+func sameType(header *tar.Header, info os.FileInfo) bool {
+	mode := info.Mode()
+	switch header.Typeflag {
+	case tar.TypeDir, typeGNUDumpDir:
+		return mode.IsDir()
+	case tar.TypeReg, tar.TypeRegA, tar.TypeLink:
+		return mode.IsRegular()
 	case tar.TypeSymlink:
-		// Создаем символическую ссылку
-		if err := os.Symlink(header.Linkname, header.Name); err != nil {
-			return 0, err
-		}
-		if verbose {
-			fmt.Printf("Создана ссылка: %s -> %s\n", header.Name, header.Linkname)
-		}
+		return mode&os.ModeSymlink != 0
+	case tar.TypeChar:
+		return mode&os.ModeCharDevice != 0
+	case tar.TypeBlock:
+		return mode&os.ModeDevice != 0 && mode&os.ModeCharDevice == 0
+	case tar.TypeFifo:
+		return mode&os.ModeNamedPipe != 0
+	}
+	return true
+}
 
-	case tar.TypeLink:
-		// Создаем жесткую ссылку
-		if err := os.Link(header.Linkname, header.Name); err != nil {
-			return 0, err
+// sameContent побайтно сравнивает содержимое члена архива и файла
+func sameContent(tr io.Reader, path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	bufA := make([]byte, 32*1024)
+	bufB := make([]byte, 32*1024)
+	for {
+		n, errA := io.ReadFull(tr, bufA)
+		if errA != nil && errA != io.EOF && errA != io.ErrUnexpectedEOF {
+			return false, errA
 		}
-		if verbose {
-			fmt.Printf("Создана жесткая ссылка: %s -> %s\n", header.Name, header.Linkname)
+		m, errB := io.ReadFull(file, bufB[:n])
+		if errB != nil && errB != io.EOF && errB != io.ErrUnexpectedEOF {
+			return false, errB
 		}
-
-	default:
-		if verbose {
-			fmt.Printf("Пропущен: %s (тип: %c)\n", header.Name, header.Typeflag)
+		if m != n || !bytes.Equal(bufA[:n], bufB[:m]) {
+			return false, nil
+		}
+		if errA != nil {
+			return true, nil
 		}
 	}
+}
 
-	// Устанавливаем время модификации
-	if !header.ModTime.IsZero() {
-		os.Chtimes(header.Name, time.Now(), header.ModTime)
-	}
+// Форматы вывода списка членов архива
+const (
+	listFormatText = "text"
+	listFormatJSON = "json"
+	listFormatCSV  = "csv"
+)
 
-	return size, nil
+// memberRecord — описание члена архива для машинно-читаемого списка
+type memberRecord struct {
+	Name     string            `json:"name"`
+	Type     string            `json:"type"`
+	Mode     string            `json:"mode"`
+	Size     int64             `json:"size"`
+	Uid      int               `json:"uid"`
+	Gid      int               `json:"gid"`
+	Uname    string            `json:"uname"`
+	Gname    string            `json:"gname"`
+	Mtime    string            `json:"mtime"`
+	Linkname string            `json:"linkname"`
+	PAX      map[string]string `json:"pax"`
 }
 
-func isSafePath(path string) bool {
-	// Проверяем, что путь не содержит опасных элементов
-	cleaned := filepath.Clean(path)
-	
-	// Запрещаем абсолютные пути и переходы наверх
-	if filepath.IsAbs(path) || strings.HasPrefix(cleaned, "..") {
-		return false
+// csvColumns — заголовок CSV, в том же порядке, что и поля memberRecord
+var csvColumns = []string{"name", "type", "mode", "size", "uid", "gid", "uname", "gname", "mtime", "linkname", "pax"}
+
+// ownerNames разрешает uid и gid в имена, когда их нет в заголовке,
+// и запоминает результаты поиска
+type ownerNames struct {
+	users  map[int]string
+	groups map[int]string
+}
+
+func (o *ownerNames) user(header *tar.Header) string {
+	if header.Uname != "" {
+		return header.Uname
 	}
-	
-	// Проверяем каждый компонент пути
-	parts := strings.Split(cleaned, string(filepath.Separator))
-	for _, part := range parts {
-		if part == ".." {
-			return false
-		}
+	if name, ok := o.users[header.Uid]; ok {
+		return name
 	}
-	
-	return true
+	name := ""
+	if u, err := user.LookupId(strconv.Itoa(header.Uid)); err == nil {
+		name = u.Username
+	}
+	o.users[header.Uid] = name
+	return name
 }
 
-func listArchive(filename string, verbose, gzipDecompress bool) error {
-	// Открываем архивный файл
-	file, err := os.Open(filename)
-	if err != nil {
-		return fmt.Errorf("не удалось открыть архив %s: %v", filename, err)
+func (o *ownerNames) group(header *tar.Header) string {
+	if header.Gname != "" {
+		return header.Gname
 	}
-	defer file.Close()
-
-	var reader io.Reader = file
-
-	// Добавляем gzip декомпрессию если нужно
-	if gzipDecompress {
-		gzReader, err := gzip.NewReader(reader)
-		if err != nil {
-			return fmt.Errorf("ошибка при распаковке gzip: %v", err)
-		}
-		defer gzReader.Close()
-		reader = gzReader
+	if name, ok := o.groups[header.Gid]; ok {
+		return name
+	}
+	name := ""
+	if g, err := user.LookupGroupId(strconv.Itoa(header.Gid)); err == nil {
+		name = g.Name
 	}
+	o.groups[header.Gid] = name
+	return name
+}
 
-	tr := tar.NewReader(reader)
+// memberType возвращает название типа члена архива
+func memberType(header *tar.Header) string {
+	switch header.Typeflag {
+	case tar.TypeDir, typeGNUDumpDir:
+		return "dir"
+	case tar.TypeReg, tar.TypeRegA:
+		return "file"
+	case tar.TypeSymlink:
+		return "symlink"
+	case tar.TypeLink:
+		return "hardlink"
+	case tar.TypeChar:
+		return "char"
+	case tar.TypeBlock:
+		return "block"
+	case tar.TypeFifo:
+		return "fifo"
+	case tar.TypeXGlobalHeader:
+		return "global"
+	default:
+		return "unknown"
+	}
+}
 
-	fmt.Printf("Содержимое архива: %s\n", filename)
-	fmt.Println()
+// writeListing выводит члены архива в формате JSON (массив объектов)
+// или CSV (строка заголовка и по строке на член)
+func writeListing(w io.Writer, tr *tar.Reader, format string, filter *memberFilter) error {
+	names := &ownerNames{users: make(map[int]string), groups: make(map[int]string)}
+	bw := bufio.NewWriter(w)
+	cw := csv.NewWriter(bw)
 
-	// Заголовок таблицы
-	if verbose {
-		fmt.Println("Права      Владелец Группа    Размер     Дата                Имя")
-		fmt.Println("---------  -------  -------  ----------  ------------------  ----")
+	if format == listFormatCSV {
+		cw.Write(csvColumns)
 	} else {
-		fmt.Println("Тип  Размер     Дата                Имя")
-		fmt.Println("---  ----------  ------------------  ----")
+		bw.WriteString("[")
 	}
 
-	totalFiles := 0
-	totalSize := int64(0)
-
-	// Выводим информацию о файлах
-	for {
-		header, err := tr.Next()
-		if err == io.EOF {
-			break
+	first := true
+	err := forEachMember(tr, filter, func(header *tar.Header) error {
+		rec := memberRecord{
+			Name:     header.Name,
+			Type:     memberType(header),
+			Mode:     fmt.Sprintf("%04o", header.Mode&07777),
+			Size:     header.Size,
+			Uid:      header.Uid,
+			Gid:      header.Gid,
+			Uname:    names.user(header),
+			Gname:    names.group(header),
+			Mtime:    header.ModTime.Format(time.RFC3339),
+			Linkname: header.Linkname,
+			PAX:      header.PAXRecords,
 		}
-		if err != nil {
-			return fmt.Errorf("ошибка чтения архива: %v", err)
+		if rec.PAX == nil {
+			rec.PAX = map[string]string{}
 		}
 
-		// Выводим информацию о файле
-		printFileInfo(header, verbose)
+		// PAX-записи в обоих форматах кодируются объектом JSON
+		// с отсортированными ключами
+		pax, err := json.Marshal(rec.PAX)
+		if err != nil {
+			return err
+		}
 
-		totalFiles++
-		if header.Typeflag == tar.TypeReg || header.Typeflag == tar.TypeRegA {
-			totalSize += header.Size
+		if format == listFormatCSV {
+			return cw.Write([]string{
+				rec.Name, rec.Type, rec.Mode, strconv.FormatInt(rec.Size, 10),
+				strconv.Itoa(rec.Uid), strconv.Itoa(rec.Gid), rec.Uname, rec.Gname,
+				rec.Mtime, rec.Linkname, string(pax),
+			})
 		}
 
-		// Пропускаем содержимое файла
-		if header.Typeflag == tar.TypeReg || header.Typeflag == tar.TypeRegA {
-			io.Copy(io.Discard, tr)
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		if !first {
+			bw.WriteString(",")
 		}
+		first = false
+		bw.WriteString("\n  ")
+		bw.Write(data)
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	fmt.Println()
-	fmt.Printf("Всего файлов: %d\n", totalFiles)
-	fmt.Printf("Общий размер: %s\n", formatBytes(totalSize))
-
-	return nil
+	if format == listFormatCSV {
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return err
+		}
+	} else {
+		if !first {
+			bw.WriteString("\n")
+		}
+		bw.WriteString("]\n")
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return filter.err()
 }
 
 func printFileInfo(header *tar.Header, verbose bool) {
 	// Определяем тип файла
 	var typeChar string
 	switch header.Typeflag {
-	case tar.TypeDir:
+	case tar.TypeDir, typeGNUDumpDir:
 		typeChar = "d"
 	case tar.TypeReg, tar.TypeRegA:
 		typeChar = "-"
@@ -514,7 +3399,7 @@ func printFileInfo(header *tar.Header, verbose bool) {
 		// Простой вывод
 		var typeStr string
 		switch header.Typeflag {
-		case tar.TypeDir:
+		case tar.TypeDir, typeGNUDumpDir:
 			typeStr = "DIR"
 		case tar.TypeReg, tar.TypeRegA:
 			typeStr = "FILE"
@@ -573,10 +3458,56 @@ func printHelp() {
 	fmt.Println("  -c, --create    Создать новый архив")
 	fmt.Println("  -x, --extract   Извлечь файлы из архива")
 	fmt.Println("  -t, --list      Вывести список файлов в архиве")
+	fmt.Println("  -r              Дописать файлы в конец несжатого архива")
+	fmt.Println("  -u              Дописать только файлы, более новые, чем в архиве")
+	fmt.Println("  -d, --diff      Сравнить архив с файловой системой")
 	fmt.Println()
 	fmt.Println("Опции:")
-	fmt.Println("  -f, --file=АРХИВ  Использовать архивный файл АРХИВ (обязательно)")
+	fmt.Println("  -f, --file=АРХИВ  Использовать архивный файл АРХИВ (обязательно);")
+	fmt.Println("                    \"-\" означает стандартный ввод или вывод")
 	fmt.Println("  -v, --verbose     Подробный вывод обрабатываемых файлов")
+	fmt.Println("  -C ДИРЕКТОРИЯ     Извлекать файлы в ДИРЕКТОРИЮ (с -d: сравнивать с ней)")
+	fmt.Println("  --strip-components=N")
+	fmt.Println("                    Удалить N начальных элементов пути при извлечении")
+	fmt.Println("  -p                Восстанавливать точные права доступа (без учета umask)")
+	fmt.Println("  --same-owner      Восстанавливать владельца и группу файлов")
+	fmt.Println("  --xattrs          Сохранять и восстанавливать расширенные атрибуты")
+	fmt.Println("  --exclude=ШАБЛОН  Исключить файлы по шаблону (по полному пути или имени)")
+	fmt.Println("  --exclude-from=ФАЙЛ")
+	fmt.Println("                    Читать шаблоны исключения из ФАЙЛА")
+	fmt.Println("  --exclude-vcs     Исключить файлы систем контроля версий (.git, .svn, ...)")
+	fmt.Println("  --sort=name       Записывать файлы директорий в порядке имен")
+	fmt.Println("  --mtime=ДАТА      Записывать ДАТУ (@секунды, ГГГГ-ММ-ДД[ ЧЧ:ММ:СС] или файл)")
+	fmt.Println("                    как время модификации всех файлов")
+	fmt.Println("  --clamp-mtime     С --mtime: заменять только время, более позднее, чем ДАТА")
+	fmt.Println("  --owner=ИМЯ[:UID] Записывать указанного владельца")
+	fmt.Println("  --group=ИМЯ[:GID] Записывать указанную группу")
+	fmt.Println("  --numeric-owner   Не записывать имена владельца и группы")
+	fmt.Println("  -W, --verify      Проверить архив после записи (размер и SHA-256 файлов)")
+	fmt.Println("  --manifest=ФАЙЛ   Записать SHA-256 членов архива в формате sha256sum")
+	fmt.Println("  -M, --multi-volume")
+	fmt.Println("                    Многотомный архив: тома АРХИВ, АРХИВ.2, АРХИВ.3, ...")
+	fmt.Println("  -L, --tape-length=РАЗМЕР")
+	fmt.Println("                    Размер тома (суффиксы K, M, G, T; кратен 512), включает -M")
+	fmt.Println("  --listed-incremental=СНИМОК")
+	fmt.Println("                    С -c: архивировать только изменения после снимка")
+	fmt.Println("                    и обновить его; с -x: удалять файлы, удаленные")
+	fmt.Println("                    к моменту создания архива")
+	fmt.Println("  --unsafe-paths    Не проверять пути и ссылки при извлечении")
+	fmt.Println("                    (только для доверенных архивов)")
+	fmt.Println("  -z                Сжатие gzip")
+	fmt.Println("  --threads=N       Число потоков сжатия gzip (по умолчанию — число ядер)")
+	fmt.Println("  --gzip-block-size=РАЗМЕР")
+	fmt.Println("                    Размер блока параллельного сжатия (по умолчанию 128K)")
+	fmt.Println("  -j                Распаковка bzip2 (только для -x и -t)")
+	fmt.Println("  -Z                Распаковка compress .Z (только для -x и -t)")
+	fmt.Println("  --format=ФОРМАТ   С -t: формат списка text (по умолчанию), json или csv")
 	fmt.Println("      --help        Показать эту справку и выйти")
 	fmt.Println()
+	fmt.Println("После -x, -t и -d можно указать имена членов архива или шаблоны,")
+	fmt.Println("тогда обрабатываются только подходящие члены.")
+	fmt.Println()
+	fmt.Println("При извлечении и просмотре формат сжатия (gzip, bzip2, zlib, .Z)")
+	fmt.Println("определяется автоматически по сигнатуре архива.")
+	fmt.Println()
 }
@@ -2,23 +2,40 @@ package main
 
 import (
 	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"encoding/binary"
 	"flag"
 	"fmt"
+	"hash"
+	"hash/crc32"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"syscall"
+	"time"
+	"unsafe"
 )
 
 func main() {
 	// Парсинг флагов
 	list := flag.Bool("l", false, "показать содержимое архива без распаковки")
+	comment := flag.Bool("z", false, "показать комментарий архива")
 	quiet := flag.Bool("q", false, "тихий режим (не выводить информацию)")
 	test := flag.Bool("t", false, "проверить целостность архива")
 	overwrite := flag.Bool("o", false, "перезаписывать существующие файлы без запроса")
 	dir := flag.String("d", "", "извлечь в указанную директорию")
 	exclude := flag.String("x", "", "исключить файлы по шаблону")
 	include := flag.String("i", "", "включать только файлы по шаблону")
+	passwordEnv := flag.String("password-env", "", "взять пароль для зашифрованных файлов из переменной окружения")
 	help := flag.Bool("h", false, "показать справку")
 	
 	flag.Usage = func() {
@@ -50,20 +67,25 @@ func main() {
 		os.Exit(1)
 	}
 	
+	// Пароль запрашивается только при встрече зашифрованного файла
+	password := &passwordSource{env: *passwordEnv}
+	
 	// Выполняем действие в зависимости от флагов
 	var err error
 	switch {
+	case *comment:
+		err = showComment(zipFile)
 	case *list:
 		err = listArchive(zipFile, *quiet, *include, *exclude)
 	case *test:
-		err = testArchive(zipFile, *quiet)
+		err = testArchive(zipFile, *quiet, password)
 	default:
 		// Распаковка
 		targetDir := *dir
 		if targetDir == "" && len(args) > 1 {
 			targetDir = args[1]
 		}
-		err = extractArchive(zipFile, targetDir, *quiet, *overwrite, *include, *exclude)
+		err = extractArchive(zipFile, targetDir, *quiet, *overwrite, *include, *exclude, password)
 	}
 	
 	if err != nil {
@@ -77,21 +99,29 @@ func printHelp() {
 Распаковывает ZIP архив.
 
 Опции:
-  -l    показать содержимое архива (без распаковки)
+  -l    показать содержимое архива (без распаковки) вместе
+        с комментариями архива и файлов
+  -z    показать только комментарий архива
   -q    тихий режим (не выводить информацию)
   -d    извлечь в указанную директорию
+  -password-env ИМЯ
+        взять пароль для зашифрованных файлов из переменной окружения ИМЯ
+        (иначе пароль запрашивается с терминала)
   -h    показать эту справку
 
+Архив из частей (архив.z01, архив.z02, ..., архив.zip) распаковывается
+по имени последней части, остальные части ищутся рядом с ней.
+
 Примеры:
   unzip archive.zip
   unzip -l archive.zip
-  unzip -d /tmp archive.zip
-`)
+  unzip -z release.zip
+  unzip -d /tmp archive.zip`)
 }
 
 func listArchive(zipFile string, quiet bool, includePattern, excludePattern string) error {
 	// Открываем архив
-	r, err := zip.OpenReader(zipFile)
+	r, err := openArchive(zipFile)
 	if err != nil {
 		return fmt.Errorf("не удалось открыть архив: %v", err)
 	}
@@ -99,6 +129,9 @@ func listArchive(zipFile string, quiet bool, includePattern, excludePattern stri
 	
 	if !quiet {
 		fmt.Printf("Архив:  %s\n", zipFile)
+		if r.Comment != "" {
+			fmt.Println(r.Comment)
+		}
 		fmt.Println(strings.Repeat("=", 60))
 		fmt.Printf("%-12s %-12s %-8s %-20s %s\n", 
 			"Длина", "Сжатый", "Метод", "Дата", "Имя")
@@ -107,6 +140,7 @@ func listArchive(zipFile string, quiet bool, includePattern, excludePattern stri
 	
 	var totalFiles int
 	var totalSize, totalCompressed uint64
+	encrypted := false
 	
 	for _, f := range r.File {
 		// Проверяем фильтры
@@ -115,10 +149,11 @@ func listArchive(zipFile string, quiet bool, includePattern, excludePattern stri
 		}
 		
 		if !quiet {
-			// Определяем метод сжатия
-			method := "Store"
-			if f.Method == zip.Deflate {
-				method = "Deflate"
+			// Определяем метод сжатия; зашифрованные файлы помечаются *
+			method := methodName(f)
+			if f.Flags&zipFlagEncrypted != 0 {
+				method += "*"
+				encrypted = true
 			}
 			
 			// Форматируем дату
@@ -130,6 +165,13 @@ func listArchive(zipFile string, quiet bool, includePattern, excludePattern stri
 				method,
 				date,
 				f.Name)
+
+			// Комментарий файла выводится под ним с отступом
+			if f.Comment != "" {
+				for _, line := range strings.Split(f.Comment, "\n") {
+					fmt.Printf("%14s%s\n", "", line)
+				}
+			}
 		}
 		
 		totalFiles++
@@ -143,14 +185,31 @@ func listArchive(zipFile string, quiet bool, includePattern, excludePattern stri
 			totalFiles,
 			formatBytes(totalSize),
 			formatBytes(totalCompressed))
+		if encrypted {
+			fmt.Println("* — файл зашифрован")
+		}
 	}
 	
 	return nil
 }
 
-func testArchive(zipFile string, quiet bool) error {
+// showComment выводит комментарий архива
+func showComment(zipFile string) error {
+	r, err := openArchive(zipFile)
+	if err != nil {
+		return fmt.Errorf("не удалось открыть архив: %v", err)
+	}
+	defer r.Close()
+
+	if r.Comment != "" {
+		fmt.Println(r.Comment)
+	}
+	return nil
+}
+
+func testArchive(zipFile string, quiet bool, password *passwordSource) error {
 	// Открываем архив
-	r, err := zip.OpenReader(zipFile)
+	r, err := openArchive(zipFile)
 	if err != nil {
 		return fmt.Errorf("не удалось открыть архив: %v", err)
 	}
@@ -165,7 +224,7 @@ func testArchive(zipFile string, quiet bool) error {
 	
 	for _, f := range r.File {
 		// Открываем файл в архиве
-		rc, err := f.Open()
+		rc, err := openEntry(f, password)
 		if err != nil {
 			if !quiet {
 				fmt.Printf("Ошибка: не удалось открыть %s: %v\n", f.Name, err)
@@ -207,7 +266,7 @@ func testArchive(zipFile string, quiet bool) error {
 	return nil
 }
 
-func extractArchive(zipFile, targetDir string, quiet, overwrite bool, includePattern, excludePattern string) error {
+func extractArchive(zipFile, targetDir string, quiet, overwrite bool, includePattern, excludePattern string, password *passwordSource) error {
 	// Определяем целевую директорию
 	if targetDir == "" {
 		targetDir = "."
@@ -219,7 +278,7 @@ func extractArchive(zipFile, targetDir string, quiet, overwrite bool, includePat
 	}
 	
 	// Открываем архив
-	r, err := zip.OpenReader(zipFile)
+	r, err := openArchive(zipFile)
 	if err != nil {
 		return fmt.Errorf("не удалось открыть архив: %v", err)
 	}
@@ -233,6 +292,7 @@ func extractArchive(zipFile, targetDir string, quiet, overwrite bool, includePat
 	
 	extractedFiles := 0
 	skippedFiles := 0
+	delayed := &delayedEntries{}
 	
 	for _, f := range r.File {
 		// Проверяем фильтры
@@ -245,7 +305,7 @@ func extractArchive(zipFile, targetDir string, quiet, overwrite bool, includePat
 		}
 		
 		// Извлекаем файл
-		err := extractFile(f, targetDir, overwrite, quiet)
+		err := extractFile(f, targetDir, overwrite, quiet, password, delayed)
 		if err != nil {
 			if !quiet {
 				fmt.Printf("Ошибка: %s: %v\n", f.Name, err)
@@ -256,6 +316,37 @@ func extractArchive(zipFile, targetDir string, quiet, overwrite bool, includePat
 		extractedFiles++
 	}
 	
+	// Ссылки создаются после всех файлов; запись через ссылку, в том числе
+	// созданную раньше в этом же цикле, запрещает safePath
+	for _, f := range delayed.symlinks {
+		if err := extractSymlink(f, targetDir, overwrite, quiet, password); err != nil {
+			if !quiet {
+				fmt.Printf("Ошибка: %s: %v\n", f.Name, err)
+			}
+			extractedFiles--
+		}
+	}
+	
+	// Права и время директорий восстанавливаются в конце, от вложенных
+	// к внешним: создание файлов внутри меняет время директории. Путь
+	// проверяется заново: директорию могла заменить ссылка из архива.
+	for i := len(delayed.dirs) - 1; i >= 0; i-- {
+		f := delayed.dirs[i]
+		path, err := safePath(targetDir, f.Name, true)
+		if err == nil {
+			var info os.FileInfo
+			if info, err = os.Lstat(path); err == nil && !info.IsDir() {
+				err = fmt.Errorf("%s больше не является директорией", path)
+			}
+		}
+		if err == nil {
+			err = restoreMetadata(path, f, false)
+		}
+		if err != nil && !quiet {
+			fmt.Printf("Предупреждение: %s: %v\n", f.Name, err)
+		}
+	}
+	
 	if !quiet {
 		fmt.Println(strings.Repeat("-", 40))
 		fmt.Printf("Извлечено файлов: %d\n", extractedFiles)
@@ -271,24 +362,93 @@ func extractArchive(zipFile, targetDir string, quiet, overwrite bool, includePat
 	return nil
 }
 
-func extractFile(f *zip.File, targetDir string, overwrite, quiet bool) error {
-	// Создаем полный путь
-	path := filepath.Join(targetDir, f.Name)
+// delayedEntries — члены архива, обработка которых откладывается
+// до конца распаковки
+type delayedEntries struct {
+	symlinks []*zip.File
+	dirs     []*zip.File
+}
+
+// safePath возвращает путь на диске для члена архива. Абсолютные имена
+// и имена с ".." отвергаются, а каждая родительская директория внутри
+// targetDir проверяется через Lstat: запись через символическую ссылку,
+// в том числе созданную этим же архивом, запрещена. Для директорий
+// проверяется и последний компонент.
+func safePath(targetDir, name string, isDir bool) (string, error) {
+	slashed := strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(slashed, "/") || filepath.IsAbs(filepath.FromSlash(slashed)) {
+		return "", fmt.Errorf("небезопасный путь: %s", name)
+	}
+	var parts []string
+	for _, part := range strings.Split(slashed, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("небезопасный путь: %s", name)
+		}
+		if part != "" && part != "." {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return "", fmt.Errorf("пустое имя члена архива")
+	}
+
+	check := len(parts) - 1
+	if isDir {
+		check = len(parts)
+	}
+	current := targetDir
+	for _, part := range parts[:check] {
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			// Дальше пути нет, он будет создан заново
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("путь %s проходит через символическую ссылку %s", name, current)
+		}
+	}
+
+	return filepath.Join(append([]string{targetDir}, parts...)...), nil
+}
+
+func extractFile(f *zip.File, targetDir string, overwrite, quiet bool, password *passwordSource, delayed *delayedEntries) error {
+	// Создаем полный путь, не выходящий за пределы targetDir
+	path, err := safePath(targetDir, f.Name, f.FileInfo().IsDir())
+	if err != nil {
+		return err
+	}
 	
 	// Проверяем, является ли это директорией
 	if f.FileInfo().IsDir() {
 		// Создаем директорию
-		return os.MkdirAll(path, f.Mode())
+		delayed.dirs = append(delayed.dirs, f)
+		return os.MkdirAll(path, 0755)
 	}
 	
-	// Проверяем, существует ли уже файл
-	if !overwrite {
-		if _, err := os.Stat(path); err == nil {
+	// Символические ссылки создаются в конце
+	if f.Mode()&os.ModeSymlink != 0 {
+		delayed.symlinks = append(delayed.symlinks, f)
+		return nil
+	}
+	
+	// Проверяем, существует ли уже файл; существующая ссылка заменяется,
+	// а не используется для записи
+	if info, err := os.Lstat(path); err == nil {
+		if !overwrite {
 			if !quiet {
 				fmt.Printf("  пропущен (существует): %s\n", f.Name)
 			}
 			return nil
 		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
 	}
 	
 	// Создаем родительские директории если нужно
@@ -298,7 +458,7 @@ func extractFile(f *zip.File, targetDir string, overwrite, quiet bool) error {
 	}
 	
 	// Открываем файл в архиве
-	rc, err := f.Open()
+	rc, err := openEntry(f, password)
 	if err != nil {
 		return fmt.Errorf("не удалось открыть в архиве: %v", err)
 	}
@@ -316,6 +476,13 @@ func extractFile(f *zip.File, targetDir string, overwrite, quiet bool) error {
 	if err != nil {
 		return fmt.Errorf("ошибка копирования %s: %v", f.Name, err)
 	}
+	if err := outFile.Close(); err != nil {
+		return fmt.Errorf("ошибка записи %s: %v", path, err)
+	}
+	
+	if err := restoreMetadata(path, f, false); err != nil {
+		return err
+	}
 	
 	if !quiet {
 		fmt.Printf("  извлечен: %s\n", f.Name)
@@ -324,6 +491,186 @@ func extractFile(f *zip.File, targetDir string, overwrite, quiet bool) error {
 	return nil
 }
 
+// extractSymlink создает символическую ссылку; путь, на который она
+// указывает, хранится как данные члена архива
+func extractSymlink(f *zip.File, targetDir string, overwrite, quiet bool, password *passwordSource) error {
+	path, err := safePath(targetDir, f.Name, false)
+	if err != nil {
+		return err
+	}
+	
+	if _, err := os.Lstat(path); err == nil {
+		if !overwrite {
+			if !quiet {
+				fmt.Printf("  пропущен (существует): %s\n", f.Name)
+			}
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("не удалось создать директорию %s: %v", filepath.Dir(path), err)
+	}
+	
+	rc, err := openEntry(f, password)
+	if err != nil {
+		return fmt.Errorf("не удалось открыть в архиве: %v", err)
+	}
+	defer rc.Close()
+	target, err := io.ReadAll(rc)
+	if err != nil {
+		return fmt.Errorf("ошибка чтения %s: %v", f.Name, err)
+	}
+	
+	if err := os.Symlink(string(target), path); err != nil {
+		return err
+	}
+	if err := restoreMetadata(path, f, true); err != nil {
+		return err
+	}
+	
+	if !quiet {
+		fmt.Printf("  извлечена ссылка: %s -> %s\n", f.Name, target)
+	}
+	
+	return nil
+}
+
+// Дополнительные поля Info-ZIP для Unix
+const (
+	extTimeExtraID = 0x5455 // расширенная метка времени
+	unixExtraID    = 0x7875 // владелец и группа (Info-ZIP Unix, версия 3)
+	creatorUnix    = 3
+)
+
+// unixExtra — сведения из дополнительных полей Info-ZIP
+type unixExtra struct {
+	atime    time.Time
+	uid, gid int
+	hasOwner bool
+}
+
+// parseUnixExtra разбирает поля 0x5455 и 0x7875
+func parseUnixExtra(extra []byte) unixExtra {
+	var info unixExtra
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		extra = extra[4:]
+		if size > len(extra) {
+			break
+		}
+		field := extra[:size]
+		extra = extra[size:]
+		
+		switch id {
+		case extTimeExtraID:
+			// Флаги, затем время модификации и доступа, если они есть
+			if len(field) < 1 {
+				continue
+			}
+			flags := field[0]
+			field = field[1:]
+			if flags&1 != 0 && len(field) >= 4 {
+				field = field[4:]
+			}
+			if flags&2 != 0 && len(field) >= 4 {
+				info.atime = time.Unix(int64(binary.LittleEndian.Uint32(field)), 0)
+			}
+		case unixExtraID:
+			// Версия, затем uid и gid переменной длины
+			if len(field) < 2 || field[0] != 1 {
+				continue
+			}
+			uid, rest, ok := readUnixID(field[1:])
+			if !ok {
+				continue
+			}
+			gid, _, ok := readUnixID(rest)
+			if !ok {
+				continue
+			}
+			info.uid, info.gid, info.hasOwner = int(uid), int(gid), true
+		}
+	}
+	return info
+}
+
+// readUnixID читает идентификатор с предшествующим байтом длины
+func readUnixID(b []byte) (uint64, []byte, bool) {
+	if len(b) < 1 || len(b) < 1+int(b[0]) || b[0] > 8 {
+		return 0, nil, false
+	}
+	n := int(b[0])
+	var id uint64
+	for i := n - 1; i >= 0; i-- {
+		id = id<<8 | uint64(b[1+i])
+	}
+	return id, b[1+n:], true
+}
+
+// restoreMetadata восстанавливает владельца (если распаковка идет от
+// root), права доступа (для архивов, созданных в Unix) и время
+func restoreMetadata(path string, f *zip.File, isLink bool) error {
+	extra := parseUnixExtra(f.Extra)
+	
+	// Владельца меняем до прав: chown сбрасывает setuid и setgid
+	if extra.hasOwner && os.Geteuid() == 0 {
+		if err := os.Lchown(path, extra.uid, extra.gid); err != nil {
+			return fmt.Errorf("не удалось установить владельца: %v", err)
+		}
+	}
+	
+	if !isLink && f.CreatorVersion>>8 == creatorUnix {
+		if err := os.Chmod(path, f.Mode().Perm()); err != nil {
+			return fmt.Errorf("не удалось установить права: %v", err)
+		}
+	}
+	
+	// Время модификации zip.Reader уже берет из поля 0x5455
+	mtime := f.Modified
+	atime := extra.atime
+	if atime.IsZero() {
+		atime = mtime
+	}
+	if isLink {
+		return lutimes(path, atime, mtime)
+	}
+	if err := os.Chtimes(path, atime, mtime); err != nil {
+		return fmt.Errorf("не удалось установить время: %v", err)
+	}
+	return nil
+}
+
+// Константы utimensat(2), которых нет в пакете syscall
+const (
+	atFDCWD           = -0x64
+	atSymlinkNoFollow = 0x100
+)
+
+// lutimes устанавливает время самой символической ссылки, а не ее цели
+func lutimes(path string, atime, mtime time.Time) error {
+	p, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return err
+	}
+	ts := [2]syscall.Timespec{
+		syscall.NsecToTimespec(atime.UnixNano()),
+		syscall.NsecToTimespec(mtime.UnixNano()),
+	}
+	dirfd := atFDCWD
+	_, _, errno := syscall.Syscall6(syscall.SYS_UTIMENSAT, uintptr(dirfd),
+		uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(&ts[0])),
+		atSymlinkNoFollow, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
 func shouldProcess(filename, includePattern, excludePattern string) bool {
 	// Получаем только имя файла (без пути) для проверки паттернов
 	baseName := filepath.Base(filename)
@@ -361,3 +708,828 @@ func formatBytes(bytes uint64) string {
 	
 	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
 }
+
+// Параметры форматов шифрования ZIP
+const (
+	zipFlagEncrypted  = 0x1
+	zipFlagDescriptor = 0x8
+
+	zipCryptoHeaderLen = 12
+
+	// WinZip AES: метод 99 и дополнительное поле 0x9901
+	methodAES        = 99
+	aesExtraID       = 0x9901
+	aesVendorAE1     = 1
+	aesVerifierLen   = 2
+	aesMACLen        = 10
+	aesKDFIterations = 1000
+)
+
+// methodName возвращает название метода сжатия файла
+func methodName(f *zip.File) string {
+	method := f.Method
+	if method == methodAES {
+		if info, err := parseAESExtra(f.Extra); err == nil {
+			method = info.method
+		}
+	}
+	switch method {
+	case zip.Store:
+		return "Store"
+	case zip.Deflate:
+		return "Deflate"
+	default:
+		return fmt.Sprintf("#%d", method)
+	}
+}
+
+// passwordSource выдает пароль для зашифрованных файлов: из переменной
+// окружения или однократным запросом с терминала
+type passwordSource struct {
+	env      string
+	password string
+	known    bool
+}
+
+func (p *passwordSource) get() (string, error) {
+	if p.known {
+		return p.password, nil
+	}
+	if p.env != "" {
+		p.password = os.Getenv(p.env)
+		if p.password == "" {
+			return "", fmt.Errorf("переменная окружения %s не задана или пуста", p.env)
+		}
+	} else {
+		password, err := readPassword("Пароль: ")
+		if err != nil {
+			return "", err
+		}
+		p.password = password
+	}
+	p.known = true
+	return p.password, nil
+}
+
+// entryReader — распакованные данные файла архива. После конца
+// распакованных данных дочитывает расшифрованный поток, чтобы
+// проверка HMAC выполнилась, даже если распаковщик остановился раньше.
+type entryReader struct {
+	io.Reader
+	closer io.Closer
+	tail   io.Reader
+}
+
+func (e *entryReader) Read(p []byte) (int, error) {
+	n, err := e.Reader.Read(p)
+	if err == io.EOF && e.tail != nil {
+		if _, tailErr := io.Copy(io.Discard, e.tail); tailErr != nil {
+			return n, tailErr
+		}
+	}
+	return n, err
+}
+
+func (e *entryReader) Close() error {
+	if e.closer != nil {
+		return e.closer.Close()
+	}
+	return nil
+}
+
+// openEntry открывает файл архива; зашифрованные файлы расшифровываются
+// (традиционное шифрование PKWARE и WinZip AES), затем распаковываются
+func openEntry(f *zip.File, password *passwordSource) (io.ReadCloser, error) {
+	if f.Flags&zipFlagEncrypted == 0 {
+		return f.Open()
+	}
+
+	pass, err := password.get()
+	if err != nil {
+		return nil, err
+	}
+	raw, err := f.OpenRaw()
+	if err != nil {
+		return nil, err
+	}
+
+	var data io.Reader
+	method := f.Method
+	checkCRC := true
+	if f.Method == methodAES {
+		info, err := parseAESExtra(f.Extra)
+		if err != nil {
+			return nil, err
+		}
+		data, err = newAESReader(raw, int64(f.CompressedSize64), info, pass)
+		if err != nil {
+			return nil, err
+		}
+		method = info.method
+		// В AE-2 CRC не записывается, целостность проверяет HMAC
+		checkCRC = info.vendor == aesVendorAE1
+	} else {
+		data, err = newZipCryptoReader(raw, f, pass)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Распаковываем расшифрованные данные
+	entry := &entryReader{tail: data}
+	switch method {
+	case zip.Store:
+		entry.Reader = data
+	case zip.Deflate:
+		fr := flate.NewReader(data)
+		entry.Reader = fr
+		entry.closer = fr
+	default:
+		return nil, fmt.Errorf("неподдерживаемый метод сжатия: %d", method)
+	}
+	if checkCRC {
+		entry.Reader = &crcReader{r: entry.Reader, hash: crc32.NewIEEE(), want: f.CRC32}
+	}
+	return entry, nil
+}
+
+// crcReader сверяет CRC прочитанных данных по достижении конца
+type crcReader struct {
+	r    io.Reader
+	hash hash.Hash32
+	want uint32
+}
+
+func (c *crcReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.hash.Write(p[:n])
+	if err == io.EOF && c.hash.Sum32() != c.want {
+		return n, zip.ErrChecksum
+	}
+	return n, err
+}
+
+// aesInfo — содержимое дополнительного поля WinZip AES
+type aesInfo struct {
+	vendor   uint16
+	strength byte
+	method   uint16
+}
+
+// parseAESExtra находит поле 0x9901 среди дополнительных полей
+func parseAESExtra(extra []byte) (aesInfo, error) {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		extra = extra[4:]
+		if size > len(extra) {
+			break
+		}
+		if id == aesExtraID && size >= 7 {
+			return aesInfo{
+				vendor:   binary.LittleEndian.Uint16(extra),
+				strength: extra[4],
+				method:   binary.LittleEndian.Uint16(extra[5:]),
+			}, nil
+		}
+		extra = extra[size:]
+	}
+	return aesInfo{}, fmt.Errorf("нет описания шифрования AES")
+}
+
+// aesReader расшифровывает данные WinZip AES и по достижении конца
+// проверяет код аутентичности HMAC-SHA1
+type aesReader struct {
+	raw    io.Reader
+	data   io.Reader
+	stream *winZipCTR
+	mac    hash.Hash
+}
+
+func newAESReader(raw io.Reader, size int64, info aesInfo, password string) (*aesReader, error) {
+	keyLen := 0
+	switch info.strength {
+	case 1:
+		keyLen = 16
+	case 2:
+		keyLen = 24
+	case 3:
+		keyLen = 32
+	default:
+		return nil, fmt.Errorf("неизвестная стойкость AES: %d", info.strength)
+	}
+	saltLen := keyLen / 2
+
+	header := make([]byte, saltLen+aesVerifierLen)
+	if _, err := io.ReadFull(raw, header); err != nil {
+		return nil, err
+	}
+	key, err := pbkdf2.Key(sha1.New, password, header[:saltLen], aesKDFIterations, 2*keyLen+aesVerifierLen)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(key[2*keyLen:], header[saltLen:]) {
+		return nil, fmt.Errorf("неверный пароль")
+	}
+	block, err := aes.NewCipher(key[:keyLen])
+	if err != nil {
+		return nil, err
+	}
+
+	dataLen := size - int64(len(header)) - aesMACLen
+	if dataLen < 0 {
+		return nil, zip.ErrFormat
+	}
+	return &aesReader{
+		raw:    raw,
+		data:   io.LimitReader(raw, dataLen),
+		stream: newWinZipCTR(block),
+		mac:    hmac.New(sha1.New, key[keyLen:2*keyLen]),
+	}, nil
+}
+
+func (a *aesReader) Read(p []byte) (int, error) {
+	n, err := a.data.Read(p)
+	a.mac.Write(p[:n])
+	a.stream.XORKeyStream(p[:n], p[:n])
+	if err == io.EOF {
+		code := make([]byte, aesMACLen)
+		if _, err := io.ReadFull(a.raw, code); err != nil {
+			return n, err
+		}
+		if !hmac.Equal(code, a.mac.Sum(nil)[:aesMACLen]) {
+			return n, fmt.Errorf("ошибка проверки подлинности (HMAC): данные повреждены")
+		}
+	}
+	return n, err
+}
+
+// winZipCTR — режим CTR в варианте WinZip: 128-битный счетчик
+// в порядке little-endian, начиная с 1
+type winZipCTR struct {
+	block   cipher.Block
+	counter [aes.BlockSize]byte
+	stream  [aes.BlockSize]byte
+	pos     int
+}
+
+func newWinZipCTR(block cipher.Block) *winZipCTR {
+	return &winZipCTR{block: block, pos: aes.BlockSize}
+}
+
+func (c *winZipCTR) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		if c.pos == aes.BlockSize {
+			for j := range c.counter {
+				c.counter[j]++
+				if c.counter[j] != 0 {
+					break
+				}
+			}
+			c.block.Encrypt(c.stream[:], c.counter[:])
+			c.pos = 0
+		}
+		dst[i] = src[i] ^ c.stream[c.pos]
+		c.pos++
+	}
+}
+
+// zipCryptoKeys — состояние традиционного шифра PKWARE
+type zipCryptoKeys [3]uint32
+
+func newZipCryptoKeys(password string) *zipCryptoKeys {
+	keys := &zipCryptoKeys{0x12345678, 0x23456789, 0x34567890}
+	for i := 0; i < len(password); i++ {
+		keys.update(password[i])
+	}
+	return keys
+}
+
+func (k *zipCryptoKeys) update(b byte) {
+	k[0] = crc32.IEEETable[byte(k[0])^b] ^ (k[0] >> 8)
+	k[1] = (k[1]+(k[0]&0xff))*134775813 + 1
+	k[2] = crc32.IEEETable[byte(k[2])^byte(k[1]>>24)] ^ (k[2] >> 8)
+}
+
+func (k *zipCryptoKeys) streamByte() byte {
+	t := k[2] | 2
+	return byte((t * (t ^ 1)) >> 8)
+}
+
+// decrypt расшифровывает буфер на месте
+func (k *zipCryptoKeys) decrypt(buf []byte) {
+	for i := range buf {
+		buf[i] ^= k.streamByte()
+		k.update(buf[i])
+	}
+}
+
+// zipCryptoReader расшифровывает данные традиционного шифра PKWARE
+type zipCryptoReader struct {
+	r    io.Reader
+	keys *zipCryptoKeys
+}
+
+func newZipCryptoReader(raw io.Reader, f *zip.File, password string) (*zipCryptoReader, error) {
+	if f.CompressedSize64 < zipCryptoHeaderLen {
+		return nil, zip.ErrFormat
+	}
+	header := make([]byte, zipCryptoHeaderLen)
+	if _, err := io.ReadFull(raw, header); err != nil {
+		return nil, err
+	}
+	keys := newZipCryptoKeys(password)
+	keys.decrypt(header)
+
+	// Последний байт заголовка — старший байт CRC, а при записи
+	// с дескриптором данных — старший байт времени модификации
+	check := byte(f.CRC32 >> 24)
+	if f.Flags&zipFlagDescriptor != 0 {
+		check = byte(f.ModifiedTime >> 8)
+	}
+	if header[zipCryptoHeaderLen-1] != check {
+		return nil, fmt.Errorf("неверный пароль")
+	}
+
+	return &zipCryptoReader{
+		r:    io.LimitReader(raw, int64(f.CompressedSize64)-zipCryptoHeaderLen),
+		keys: keys,
+	}, nil
+}
+
+func (z *zipCryptoReader) Read(p []byte) (int, error) {
+	n, err := z.r.Read(p)
+	z.keys.decrypt(p[:n])
+	return n, err
+}
+
+// readPassword читает строку с терминала, отключив эхо
+func readPassword(prompt string) (string, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", fmt.Errorf("не удалось открыть терминал для ввода пароля (используйте -password-env): %v", err)
+	}
+	defer tty.Close()
+
+	fd := tty.Fd()
+	var state syscall.Termios
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCGETS, uintptr(unsafe.Pointer(&state))); errno != 0 {
+		return "", fmt.Errorf("не удалось настроить терминал: %v", errno)
+	}
+	noEcho := state
+	noEcho.Lflag &^= syscall.ECHO
+	noEcho.Lflag |= syscall.ICANON | syscall.ISIG
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCSETS, uintptr(unsafe.Pointer(&noEcho))); errno != 0 {
+		return "", fmt.Errorf("не удалось настроить терминал: %v", errno)
+	}
+	defer syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCSETS, uintptr(unsafe.Pointer(&state)))
+
+	fmt.Fprint(tty, prompt)
+	line, err := bufio.NewReader(tty).ReadString('\n')
+	fmt.Fprintln(tty)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// Поля составного (split) архива. Архив из частей — обычный ZIP,
+// разрезанный на файлы .z01, .z02, ..., .zip; смещения в центральном
+// каталоге и записях конца каталога отсчитываются от начала части,
+// в которой находится запись, а номер части хранится рядом.
+//
+// Этот блок, до zip64Fields включительно, повторяется в zip.go:
+// изменения нужно вносить в оба файла. Тест zip_split_test.go
+// проверяет этот код и то, что копии совпадают.
+const (
+	splitMarker       = 0x08074b50 // сигнатура в начале первой части
+	centralHeaderSig  = 0x02014b50
+	directoryEndSig   = 0x06054b50
+	directory64EndSig = 0x06064b50
+	directory64LocSig = 0x07064b50
+	centralHeaderLen  = 46
+	directoryEndLen   = 22
+	directory64EndLen = 56
+	directory64LocLen = 20
+	zip64ExtraID      = 0x0001
+	uint16max         = 0xffff
+	uint32max         = 0xffffffff
+)
+
+// directoryEnd — поля записей конца центрального каталога
+type directoryEnd struct {
+	disk        uint32 // номер части с записью конца каталога
+	cdDisk      uint32 // номер части, где начинается каталог
+	diskEntries uint64 // записей каталога в последней части
+	entries     uint64 // всего записей каталога
+	cdSize      uint64
+	cdOffset    uint64 // смещение каталога от начала его части
+	comment     []byte
+}
+
+// findDirectoryEnd ищет запись конца каталога в хвосте архива;
+// длина комментария должна совпадать с оставшимися байтами
+func findDirectoryEnd(buf []byte) (int, bool) {
+	for i := len(buf) - directoryEndLen; i >= 0; i-- {
+		if binary.LittleEndian.Uint32(buf[i:]) != directoryEndSig {
+			continue
+		}
+		commentLen := int(binary.LittleEndian.Uint16(buf[i+20:]))
+		if i+directoryEndLen+commentLen == len(buf) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// parseDirectoryEnd разбирает запись конца каталога; значения, не
+// поместившиеся в 16 или 32 бита, затем берутся из записи Zip64
+func parseDirectoryEnd(rec []byte) directoryEnd {
+	le := binary.LittleEndian
+	return directoryEnd{
+		disk:        uint32(le.Uint16(rec[4:])),
+		cdDisk:      uint32(le.Uint16(rec[6:])),
+		diskEntries: uint64(le.Uint16(rec[8:])),
+		entries:     uint64(le.Uint16(rec[10:])),
+		cdSize:      uint64(le.Uint32(rec[12:])),
+		cdOffset:    uint64(le.Uint32(rec[16:])),
+		comment:     rec[directoryEndLen:],
+	}
+}
+
+// needsZip64 — не помещается ли какое-то поле в обычную запись
+func (d *directoryEnd) needsZip64() bool {
+	return d.disk >= uint16max || d.cdDisk >= uint16max ||
+		d.diskEntries >= uint16max || d.entries >= uint16max ||
+		d.cdSize >= uint32max || d.cdOffset >= uint32max
+}
+
+// parseDirectory64Locator разбирает локатор Zip64: номер части и
+// смещение записи Zip64 конца каталога
+func parseDirectory64Locator(rec []byte) (uint32, uint64, bool) {
+	if len(rec) < directory64LocLen || binary.LittleEndian.Uint32(rec) != directory64LocSig {
+		return 0, 0, false
+	}
+	return binary.LittleEndian.Uint32(rec[4:]), binary.LittleEndian.Uint64(rec[8:]), true
+}
+
+// applyDirectory64End заменяет поля значениями из записи Zip64
+func (d *directoryEnd) applyDirectory64End(rec []byte) error {
+	le := binary.LittleEndian
+	if len(rec) < directory64EndLen || le.Uint32(rec) != directory64EndSig {
+		return fmt.Errorf("повреждена запись Zip64 конца каталога")
+	}
+	d.disk = le.Uint32(rec[16:])
+	d.cdDisk = le.Uint32(rec[20:])
+	d.diskEntries = le.Uint64(rec[24:])
+	d.entries = le.Uint64(rec[32:])
+	d.cdSize = le.Uint64(rec[40:])
+	d.cdOffset = le.Uint64(rec[48:])
+	return nil
+}
+
+// appendDirectoryEnd дописывает записи конца каталога: при необходимости
+// запись Zip64 и локатор (zip64Offset — смещение записи Zip64 от начала
+// последней части), затем обычную запись с комментарием
+func appendDirectoryEnd(b []byte, d directoryEnd, zip64Offset uint64) []byte {
+	le := binary.LittleEndian
+	if d.needsZip64() {
+		b = le.AppendUint32(b, directory64EndSig)
+		b = le.AppendUint64(b, directory64EndLen-12)
+		b = le.AppendUint16(b, 45) // версия создания
+		b = le.AppendUint16(b, 45) // версия для извлечения
+		b = le.AppendUint32(b, d.disk)
+		b = le.AppendUint32(b, d.cdDisk)
+		b = le.AppendUint64(b, d.diskEntries)
+		b = le.AppendUint64(b, d.entries)
+		b = le.AppendUint64(b, d.cdSize)
+		b = le.AppendUint64(b, d.cdOffset)
+
+		b = le.AppendUint32(b, directory64LocSig)
+		b = le.AppendUint32(b, d.disk)
+		b = le.AppendUint64(b, zip64Offset)
+		b = le.AppendUint32(b, d.disk+1) // всего частей
+	}
+
+	b = le.AppendUint32(b, directoryEndSig)
+	b = le.AppendUint16(b, uint16(min(d.disk, uint16max)))
+	b = le.AppendUint16(b, uint16(min(d.cdDisk, uint16max)))
+	b = le.AppendUint16(b, uint16(min(d.diskEntries, uint16max)))
+	b = le.AppendUint16(b, uint16(min(d.entries, uint16max)))
+	b = le.AppendUint32(b, uint32(min(d.cdSize, uint32max)))
+	b = le.AppendUint32(b, uint32(min(d.cdOffset, uint32max)))
+	b = le.AppendUint16(b, uint16(len(d.comment)))
+	return append(b, d.comment...)
+}
+
+// centralEntryLen возвращает длину записи центрального каталога
+func centralEntryLen(buf []byte) (int, error) {
+	le := binary.LittleEndian
+	if len(buf) < centralHeaderLen || le.Uint32(buf) != centralHeaderSig {
+		return 0, fmt.Errorf("повреждена запись центрального каталога")
+	}
+	n := centralHeaderLen + int(le.Uint16(buf[28:])) + int(le.Uint16(buf[30:])) + int(le.Uint16(buf[32:]))
+	if n > len(buf) {
+		return 0, fmt.Errorf("повреждена запись центрального каталога")
+	}
+	return n, nil
+}
+
+// entryLocation возвращает номер части и смещение локального заголовка
+// члена архива по записи центрального каталога
+func entryLocation(rec []byte) (uint32, uint64) {
+	le := binary.LittleEndian
+	disk := uint32(le.Uint16(rec[34:]))
+	offset := uint64(le.Uint32(rec[42:]))
+
+	// Значения-заполнители означают, что поле лежит в дополнении Zip64,
+	// куда попадают по порядку: размеры, смещение, номер части
+	fields := zip64Fields(rec)
+	next := func(n int) ([]byte, bool) {
+		if len(fields) < n {
+			return nil, false
+		}
+		v := fields[:n]
+		fields = fields[n:]
+		return v, true
+	}
+	if le.Uint32(rec[24:]) == uint32max {
+		next(8)
+	}
+	if le.Uint32(rec[20:]) == uint32max {
+		next(8)
+	}
+	if offset == uint32max {
+		if v, ok := next(8); ok {
+			offset = le.Uint64(v)
+		}
+	}
+	if disk == uint16max {
+		if v, ok := next(4); ok {
+			disk = le.Uint32(v)
+		}
+	}
+	return disk, offset
+}
+
+// relocateEntry возвращает запись центрального каталога с новыми номером
+// части и смещением локального заголовка; дополнение Zip64 собирается
+// заново, остальные дополнительные поля сохраняются
+func relocateEntry(rec []byte, disk uint32, offset uint64) []byte {
+	le := binary.LittleEndian
+	nameLen := int(le.Uint16(rec[28:]))
+	extraLen := int(le.Uint16(rec[30:]))
+	extra := rec[centralHeaderLen+nameLen : centralHeaderLen+nameLen+extraLen]
+
+	// Размеры из старого дополнения Zip64 переносятся как есть
+	var zip64 []byte
+	fields := zip64Fields(rec)
+	for _, pos := range []int{24, 20} {
+		if le.Uint32(rec[pos:]) == uint32max && len(fields) >= 8 {
+			zip64 = append(zip64, fields[:8]...)
+			fields = fields[8:]
+		}
+	}
+
+	fixed := append([]byte(nil), rec[:centralHeaderLen]...)
+	if offset >= uint32max {
+		le.PutUint32(fixed[42:], uint32max)
+		zip64 = le.AppendUint64(zip64, offset)
+	} else {
+		le.PutUint32(fixed[42:], uint32(offset))
+	}
+	if disk >= uint16max {
+		le.PutUint16(fixed[34:], uint16max)
+		zip64 = le.AppendUint32(zip64, disk)
+	} else {
+		le.PutUint16(fixed[34:], uint16(disk))
+	}
+
+	var newExtra []byte
+	if len(zip64) > 0 {
+		newExtra = le.AppendUint16(newExtra, zip64ExtraID)
+		newExtra = le.AppendUint16(newExtra, uint16(len(zip64)))
+		newExtra = append(newExtra, zip64...)
+	}
+	for len(extra) >= 4 {
+		id := le.Uint16(extra)
+		size := min(int(le.Uint16(extra[2:])), len(extra)-4)
+		if id != zip64ExtraID {
+			newExtra = append(newExtra, extra[:4+size]...)
+		}
+		extra = extra[4+size:]
+	}
+	le.PutUint16(fixed[30:], uint16(len(newExtra)))
+
+	out := append(fixed, rec[centralHeaderLen:centralHeaderLen+nameLen]...)
+	out = append(out, newExtra...)
+	return append(out, rec[centralHeaderLen+nameLen+extraLen:]...)
+}
+
+// zip64Fields возвращает данные дополнения Zip64 записи каталога
+func zip64Fields(rec []byte) []byte {
+	le := binary.LittleEndian
+	nameLen := int(le.Uint16(rec[28:]))
+	extraLen := int(le.Uint16(rec[30:]))
+	extra := rec[centralHeaderLen+nameLen : centralHeaderLen+nameLen+extraLen]
+	for len(extra) >= 4 {
+		id := le.Uint16(extra)
+		size := min(int(le.Uint16(extra[2:])), len(extra)-4)
+		if id == zip64ExtraID {
+			return extra[4 : 4+size]
+		}
+		extra = extra[4+size:]
+	}
+	return nil
+}
+
+// archive — открытый архив: обычный или собранный из частей
+type archive struct {
+	*zip.Reader
+	files []*os.File
+}
+
+func (a *archive) Close() error {
+	var firstErr error
+	for _, file := range a.files {
+		if err := file.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// openArchive открывает архив. Если запись конца каталога говорит, что
+// это последняя часть составного архива, части архив.z01, архив.z02, ...
+// склеиваются в одно целое, а центральный каталог пересчитывается из
+// номеров частей в смещения от начала склейки — дальше архив читается
+// обычным zip.Reader.
+func openArchive(name string) (*archive, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	a := &archive{files: []*os.File{file}}
+	ok := false
+	defer func() {
+		if !ok {
+			a.Close()
+		}
+	}()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+
+	end, found, err := readDirectoryEnd(file, size)
+	if err != nil {
+		return nil, err
+	}
+	if !found || end.disk == 0 {
+		a.Reader, err = zip.NewReader(file, size)
+		if err != nil {
+			return nil, err
+		}
+		ok = true
+		return a, nil
+	}
+
+	// Открываем остальные части; последняя — сам архив
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	var parts []*io.SectionReader
+	starts := make([]int64, 0, end.disk+1)
+	var total int64
+	for disk := uint32(0); disk <= end.disk; disk++ {
+		part := file
+		if disk < end.disk {
+			partName := base + fmt.Sprintf(".z%02d", disk+1)
+			part, err = os.Open(partName)
+			if err != nil {
+				return nil, fmt.Errorf("не найдена часть архива %s: %v", partName, err)
+			}
+			a.files = append(a.files, part)
+		}
+		partInfo, err := part.Stat()
+		if err != nil {
+			return nil, err
+		}
+		starts = append(starts, total)
+		parts = append(parts, io.NewSectionReader(part, 0, partInfo.Size()))
+		total += partInfo.Size()
+	}
+	joined := newConcatReader(parts...)
+
+	// Читаем центральный каталог и переводим смещения в абсолютные
+	if end.cdDisk > end.disk {
+		return nil, fmt.Errorf("неверный номер части центрального каталога")
+	}
+	cdStart := starts[end.cdDisk] + int64(end.cdOffset)
+	if end.cdSize > uint64(total-cdStart) {
+		return nil, fmt.Errorf("центральный каталог выходит за пределы архива")
+	}
+	cd := make([]byte, end.cdSize)
+	if _, err := joined.ReadAt(cd, cdStart); err != nil {
+		return nil, fmt.Errorf("не удалось прочитать центральный каталог: %v", err)
+	}
+
+	var directory []byte
+	for len(cd) > 0 {
+		n, err := centralEntryLen(cd)
+		if err != nil {
+			return nil, err
+		}
+		disk, offset := entryLocation(cd[:n])
+		if disk > end.disk {
+			return nil, fmt.Errorf("неверный номер части в центральном каталоге")
+		}
+		directory = append(directory, relocateEntry(cd[:n], 0, uint64(starts[disk])+offset)...)
+		cd = cd[n:]
+	}
+
+	joinedEnd := directoryEnd{
+		diskEntries: end.entries,
+		entries:     end.entries,
+		cdSize:      uint64(len(directory)),
+		cdOffset:    uint64(cdStart),
+		comment:     end.comment,
+	}
+	tail := appendDirectoryEnd(directory, joinedEnd, uint64(cdStart)+uint64(len(directory)))
+
+	view := newConcatReader(
+		io.NewSectionReader(joined, 0, cdStart),
+		io.NewSectionReader(bytes.NewReader(tail), 0, int64(len(tail))),
+	)
+	a.Reader, err = zip.NewReader(view, view.size)
+	if err != nil {
+		return nil, err
+	}
+	ok = true
+	return a, nil
+}
+
+// readDirectoryEnd читает записи конца каталога из последней части;
+// запись Zip64 ищется в ней же
+func readDirectoryEnd(file *os.File, size int64) (directoryEnd, bool, error) {
+	tailLen := min(size, directoryEndLen+uint16max+directory64LocLen)
+	tail := make([]byte, tailLen)
+	if _, err := file.ReadAt(tail, size-tailLen); err != nil {
+		return directoryEnd{}, false, err
+	}
+
+	endPos, found := findDirectoryEnd(tail)
+	if !found {
+		return directoryEnd{}, false, nil
+	}
+	end := parseDirectoryEnd(tail[endPos:])
+	if endPos >= directory64LocLen {
+		if _, offset, ok := parseDirectory64Locator(tail[endPos-directory64LocLen:]); ok {
+			rec := make([]byte, directory64EndLen)
+			if _, err := file.ReadAt(rec, int64(offset)); err != nil {
+				return directoryEnd{}, false, fmt.Errorf("не удалось прочитать запись Zip64: %v", err)
+			}
+			if err := end.applyDirectory64End(rec); err != nil {
+				return directoryEnd{}, false, err
+			}
+		}
+	}
+	return end, true, nil
+}
+
+// concatReader склеивает несколько частей в одно пространство смещений
+type concatReader struct {
+	parts  []*io.SectionReader
+	starts []int64
+	size   int64
+}
+
+func newConcatReader(parts ...*io.SectionReader) *concatReader {
+	c := &concatReader{parts: parts}
+	for _, part := range parts {
+		c.starts = append(c.starts, c.size)
+		c.size += part.Size()
+	}
+	return c
+}
+
+func (c *concatReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("отрицательное смещение")
+	}
+	total := 0
+	for len(p) > 0 {
+		if off >= c.size {
+			return total, io.EOF
+		}
+		i := sort.Search(len(c.starts), func(i int) bool { return c.starts[i] > off }) - 1
+		n, err := c.parts[i].ReadAt(p, off-c.starts[i])
+		total += n
+		off += int64(n)
+		p = p[n:]
+		if err != nil && err != io.EOF {
+			return total, err
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,140 @@
+// Тесты unzip.go. Каталог содержит несколько программ, поэтому тест
+// запускается вместе со своей программой:
+//
+//	go test unzip.go unzip_test.go
+package main
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// buildZip собирает zip.go: составной архив пишет splitWriter из другой
+// программы, поэтому тест запускает ее как отдельный процесс
+func buildZip(t *testing.T) string {
+	t.Helper()
+	goTool := filepath.Join(runtime.GOROOT(), "bin", "go")
+	if _, err := os.Stat(goTool); err != nil {
+		t.Skip("не найден go для сборки zip.go")
+	}
+	bin := filepath.Join(t.TempDir(), "zip")
+	if out, err := exec.Command(goTool, "build", "-o", bin, "zip.go").CombinedOutput(); err != nil {
+		t.Fatalf("сборка zip.go: %v\n%s", err, out)
+	}
+	return bin
+}
+
+// Составной архив, записанный zip -s, читается через openArchive
+func TestSplitRoundTrip(t *testing.T) {
+	zipBin := buildZip(t)
+	random := rand.New(rand.NewSource(1))
+	noise := func(n int) []byte {
+		data := make([]byte, n)
+		random.Read(data)
+		return data
+	}
+
+	tests := []struct {
+		name   string
+		files  map[string][]byte
+		single bool // архив должен уместиться в одну часть
+	}{
+		{
+			// Член больше части занимает несколько частей подряд
+			name: "несколько частей",
+			files: map[string][]byte{
+				"big.bin":      noise(300 << 10),
+				"text.txt":     []byte(strings.Repeat("строка текста\n", 20000)),
+				"sub/a.bin":    noise(70 << 10),
+				"sub/b.bin":    noise(10 << 10),
+				"sub/empty":    {},
+				"sub/deep/c.t": []byte("вложенный файл\n"),
+			},
+		},
+		{
+			// Архив, уместившийся в одну часть, помечается "PK00"
+			name: "одна часть",
+			files: map[string][]byte{
+				"a.txt": []byte("содержимое\n"),
+				"b.bin": noise(1 << 10),
+			},
+			single: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, data := range tt.files {
+				path := filepath.Join(dir, filepath.FromSlash(name))
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, data, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			out := filepath.Join(t.TempDir(), "set.zip")
+			cmd := exec.Command(zipBin, "-q", "-r", "-s", "64k", "--root", dir, out, dir)
+			if msg, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("zip -s: %v\n%s", err, msg)
+			}
+			parts, err := filepath.Glob(strings.TrimSuffix(out, ".zip") + ".z*")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Иначе хотя бы один член занимает больше двух частей
+			if tt.single != (len(parts) == 1) || (!tt.single && len(parts) < 3) {
+				t.Fatalf("частей %d: %v", len(parts), parts)
+			}
+			if tt.single {
+				head, err := os.ReadFile(out)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.HasPrefix(head, []byte("PK00")) {
+					t.Errorf("архив из одной части начинается с %q, ожидалось PK00", head[:4])
+				}
+			}
+
+			a, err := openArchive(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer a.Close()
+
+			got := make(map[string][]byte)
+			for _, f := range a.File {
+				if strings.HasSuffix(f.Name, "/") {
+					continue
+				}
+				rc, err := f.Open()
+				if err != nil {
+					t.Fatalf("%s: %v", f.Name, err)
+				}
+				data, err := io.ReadAll(rc)
+				rc.Close()
+				if err != nil {
+					t.Fatalf("%s: %v", f.Name, err)
+				}
+				got[f.Name] = data
+			}
+			if len(got) != len(tt.files) {
+				t.Errorf("файлов %d, ожидалось %d", len(got), len(tt.files))
+			}
+			for name, data := range tt.files {
+				if !bytes.Equal(got[name], data) {
+					t.Errorf("%s: %d байт, ожидалось %d", name, len(got[name]), len(data))
+				}
+			}
+		})
+	}
+}
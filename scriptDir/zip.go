@@ -2,12 +2,32 @@ package main
 
 import (
 	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
 	"flag"
 	"fmt"
+	"hash"
+	"hash/crc32"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
 )
 
 func main() {
@@ -15,13 +35,38 @@ func main() {
 	recursive := flag.Bool("r", false, "рекурсивно обходить директории")
 	quiet := flag.Bool("q", false, "тихий режим (не выводить информацию)")
 	help := flag.Bool("h", false, "показать справку")
-	exclude := flag.String("e", "", "исключить файлы по шаблону (например, *.tmp)")
+	var excludes, includes stringList
+	flag.Var(&excludes, "x", "исключить файлы по шаблону (можно указывать несколько раз, @файл — список)")
+	flag.Var(&includes, "i", "добавлять только файлы по шаблону (можно указывать несколько раз, @файл — список)")
+	gitignore := flag.Bool("gitignore", false, "учитывать файлы .gitignore, найденные при обходе")
+	encrypt := flag.Bool("e", false, "зашифровать файлы паролем")
+	passwordEnv := flag.String("password-env", "", "взять пароль из переменной окружения (включает -e)")
+	encryptionName := flag.String("encryption", "zipcrypto", "метод шифрования: zipcrypto или aes256")
+	update := flag.Bool("u", false, "добавить новые и обновить измененные файлы в существующем архиве")
+	freshen := flag.Bool("f", false, "обновить в архиве только уже имеющиеся файлы")
+	deletePattern := flag.String("d", "", "удалить из архива члены по шаблону")
+	junkPaths := flag.Bool("j", false, "сохранять только имена файлов, без путей")
+	var root string
+	flag.StringVar(&root, "C", "", "сохранять пути относительно директории")
+	flag.StringVar(&root, "root", "", "сохранять пути относительно директории")
+	symlinks := flag.Bool("y", false, "сохранять символические ссылки как ссылки")
+	verbose := flag.Bool("v", false, "подробный вывод (степень сжатия каждого файла)")
+	storeSuffixes := flag.String("n", "", "не сжимать файлы с суффиксами (через двоеточие: .jpg:.png:.gz)")
+	commentStdin := flag.Bool("z", false, "прочитать комментарий архива из стандартного ввода")
+	commentFile := flag.String("comment-file", "", "прочитать комментарий архива из файла")
+	entryComments := flag.String("c", "", "файл с комментариями членов архива (имя<TAB>комментарий)")
+	splitSize := flag.String("s", "", "разбить архив на части указанного размера (например, 2g, 650m)")
+	jobs := flag.Int("jobs", runtime.NumCPU(), "число потоков сжатия")
+	var levelFlags [10]*bool
+	for i := range levelFlags {
+		levelFlags[i] = flag.Bool(strconv.Itoa(i), false, fmt.Sprintf("уровень сжатия %d", i))
+	}
 
 	flag.Usage = func() {
 		printHelp()
 	}
 
-	flag.Parse()
+	flag.CommandLine.Parse(splitListFileArgs(os.Args[1:]))
 
 	// Проверяем флаг помощи
 	if *help {
@@ -29,37 +74,203 @@ func main() {
 		return
 	}
 
-	// Проверяем аргументы
+	// Проверяем режим работы
+	modes := 0
+	for _, set := range []bool{*update, *freshen, *deletePattern != ""} {
+		if set {
+			modes++
+		}
+	}
+	if modes > 1 {
+		fmt.Fprintln(os.Stderr, "Ошибка: опции -u, -f и -d нельзя использовать вместе")
+		os.Exit(1)
+	}
+
+	// Проверяем аргументы; -f и -d могут работать только с именем архива
 	args := flag.Args()
-	if len(args) < 2 {
+	minArgs := 2
+	if *freshen || *deletePattern != "" {
+		minArgs = 1
+	}
+	if len(args) < minArgs {
 		fmt.Fprintln(os.Stderr, "Ошибка: требуется указать имя zip файла и файлы для архивирования")
 		fmt.Fprintln(os.Stderr, "Использование: zip [опции] archive.zip file1 file2 ...")
 		os.Exit(1)
 	}
 
-	// Первый аргумент - имя архива
+	// Первый аргумент - имя архива; "-" означает стандартный вывод
 	zipName := args[0]
+	if zipName == stdioName && modes > 0 {
+		fmt.Fprintln(os.Stderr, "Ошибка: опции -u, -f и -d не работают с архивом в стандартном выводе")
+		os.Exit(1)
+	}
+
+	if *splitSize != "" && (zipName == stdioName || modes > 0) {
+		fmt.Fprintln(os.Stderr, "Ошибка: архив из частей (-s) можно только создать в файле")
+		os.Exit(1)
+	}
 
 	// Проверяем расширение .zip
-	if !strings.HasSuffix(strings.ToLower(zipName), ".zip") {
+	if zipName != stdioName && !strings.HasSuffix(strings.ToLower(zipName), ".zip") {
 		zipName = zipName + ".zip"
 	}
 
-	// Остальные аргументы - файлы для архивирования
+	// Остальные аргументы - файлы для архивирования; "-" — стандартный ввод
 	filesToZip := args[1:]
+	stdinMembers := 0
+	for _, file := range filesToZip {
+		if file == stdioName {
+			stdinMembers++
+		}
+	}
+	if stdinMembers > 1 {
+		fmt.Fprintln(os.Stderr, "Ошибка: стандартный ввод можно указать только один раз")
+		os.Exit(1)
+	}
+	if *commentStdin && (stdinMembers > 0 || *commentFile != "") {
+		fmt.Fprintln(os.Stderr, "Ошибка: -z нельзя использовать вместе с файлом \"-\" или -comment-file")
+		os.Exit(1)
+	}
+
+	// Когда архив пишется в стандартный вывод, сообщения идут в stderr
+	logOut := io.Writer(os.Stdout)
+	if zipName == stdioName {
+		logOut = os.Stderr
+	}
+
+	opts := zipOptions{
+		recursive: *recursive,
+		quiet:     *quiet,
+		verbose:   *verbose && !*quiet,
+		symlinks:  *symlinks,
+		filter:    pathFilter{gitignore: *gitignore},
+		level:     flate.DefaultCompression,
+		report:    &entryReport{},
+		log:       logOut,
+		jobs:      *jobs,
+	}
+	if *junkPaths && root != "" {
+		fmt.Fprintln(os.Stderr, "Ошибка: опции -j и --root нельзя использовать вместе")
+		os.Exit(1)
+	}
+	opts.junkPaths = *junkPaths
+	if root != "" {
+		info, err := os.Stat(root)
+		if err == nil && !info.IsDir() {
+			err = fmt.Errorf("%s не является директорией", root)
+		}
+		if err == nil {
+			opts.root, err = filepath.Abs(root)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Ошибка: корень --root: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if opts.jobs < 1 {
+		fmt.Fprintln(os.Stderr, "Ошибка: число потоков --jobs должно быть не меньше 1")
+		os.Exit(1)
+	}
+
+	// Шаблоны -x и -i; "@файл" означает список шаблонов из файла
+	var err error
+	if opts.filter.exclude, err = loadPatterns(excludes); err == nil {
+		opts.filter.include, err = loadPatterns(includes)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Размер части архива
+	if *splitSize != "" {
+		opts.splitSize, err = parseSize(*splitSize)
+		if err == nil && opts.splitSize < minSplitSize {
+			err = fmt.Errorf("размер части не может быть меньше 64k")
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Ошибка: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Комментарий архива и комментарии членов
+	if *commentStdin || *commentFile != "" {
+		opts.comment, err = readArchiveComment(*commentFile)
+	}
+	if err == nil && *entryComments != "" {
+		opts.comments, err = loadEntryComments(*entryComments)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Ошибка: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Уровень сжатия: -0 (без сжатия) ... -9 (максимальное)
+	levels := 0
+	for i, set := range levelFlags {
+		if *set {
+			opts.level = i
+			levels++
+		}
+	}
+	if levels > 1 {
+		fmt.Fprintln(os.Stderr, "Ошибка: можно указать только один уровень сжатия -0 ... -9")
+		os.Exit(1)
+	}
+	if *storeSuffixes != "" {
+		for _, suffix := range strings.Split(*storeSuffixes, ":") {
+			if suffix != "" {
+				opts.storeSuffixes = append(opts.storeSuffixes, strings.ToLower(suffix))
+			}
+		}
+	}
+
+	// Шифрование: пароль запрашивается с терминала или берется из окружения
+	if (*encrypt || *passwordEnv != "") && *deletePattern == "" {
+		method, err := parseEncryption(*encryptionName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Ошибка: %v\n", err)
+			os.Exit(1)
+		}
+		opts.encryption = method
+		opts.password, err = getPassword(*passwordEnv)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Ошибка: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
-	// Создаем архив
-	err := createZip(zipName, filesToZip, *recursive, *quiet, *exclude)
+	// Изменяем существующий архив или создаем новый
+	switch {
+	case *update:
+		err = updateZip(zipName, filesToZip, opts, modeUpdate, nil)
+	case *freshen:
+		err = updateZip(zipName, filesToZip, opts, modeFreshen, nil)
+	case *deletePattern != "":
+		// Остальные аргументы после имени архива — тоже шаблоны
+		patterns := append([]string{*deletePattern}, filesToZip...)
+		err = updateZip(zipName, nil, opts, modeDelete, patterns)
+	default:
+		err = createZip(zipName, filesToZip, opts)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Ошибка: %v\n", err)
 		os.Exit(1)
 	}
 
 	if !*quiet {
-		fmt.Printf("Архив создан: %s\n", zipName)
+		if modes > 0 {
+			fmt.Fprintf(logOut, "Архив обновлен: %s\n", zipName)
+		} else {
+			fmt.Fprintf(logOut, "Архив создан: %s\n", zipName)
+		}
 	}
 }
 
+// stdioName — имя архива или файла, означающее стандартный вывод или ввод
+const stdioName = "-"
+
 func printHelp() {
 	fmt.Println(`Использование: zip [опции] архив.zip файл1 файл2 ...
 Создает ZIP архив из указанных файлов.
@@ -67,33 +278,518 @@ func printHelp() {
 Опции:
   -r    рекурсивно обходить директории
   -q    тихий режим (не выводить информацию о процессе)
-  -e    исключить файлы по шаблону (например: *.tmp, *.log)
+  -x ШАБЛОН
+        исключить файлы по шаблону (можно указывать несколько раз);
+        -x@файл читает шаблоны из файла, по одному в строке
+  -i ШАБЛОН
+        добавлять только файлы, подходящие под шаблон (можно указывать
+        несколько раз, -i@файл — из файла)
+  --gitignore
+        учитывать файлы .gitignore, найденные при обходе директорий
+  -e    зашифровать файлы паролем (пароль запрашивается без отображения)
+  -password-env ИМЯ
+        взять пароль из переменной окружения ИМЯ (включает -e)
+  -encryption МЕТОД
+        метод шифрования: zipcrypto (традиционный PKWARE, по умолчанию)
+        или aes256 (WinZip AES-256, AE-2)
+  -u    добавить новые и обновить измененные файлы в существующем архиве
+  -f    обновить только файлы, уже имеющиеся в архиве (без списка
+        файлов — все члены архива)
+  -d ШАБЛОН
+        удалить из архива члены по шаблону (следующие аргументы —
+        тоже шаблоны)
+  -0 ... -9
+        уровень сжатия: -0 — без сжатия, -1 — быстрее, -9 — лучше
+        (по умолчанию -6)
+  -n СУФФИКСЫ
+        не сжимать файлы с указанными суффиксами, через двоеточие
+        (например: .jpg:.png:.gz)
+  -v    подробный вывод: степень сжатия каждого файла
+  -z    прочитать комментарий архива из стандартного ввода
+  -comment-file ФАЙЛ
+        прочитать комментарий архива из файла
+  -c ФАЙЛ
+        комментарии членов архива: в каждой строке имя члена и
+        комментарий через табуляцию ("\n" — перевод строки)
+  -s РАЗМЕР
+        разбить архив на части не больше РАЗМЕРА (суффиксы k, m, g;
+        не меньше 64k): архив.z01, архив.z02, ..., архив.zip
+  --jobs=N
+        число потоков сжатия (по умолчанию — число ядер); содержимое
+        архива от него не зависит. Файл, очередь записи которого еще
+        не подошла, сжимается в память (до 4 МБ), а сверх того — во
+        временный файл в $TMPDIR: при N потоках там может понадобиться
+        место под сжатые данные до 2×N файлов
+  -j    сохранять только имена файлов, без путей (директории не
+        сохраняются); одинаковые имена — ошибка
+  -C ДИР, --root=ДИР
+        сохранять пути относительно директории ДИР; файлы вне нее
+        пропускаются с предупреждением
+  -y    сохранять символические ссылки как ссылки, а не содержимое
+        их целей
   -h    показать эту справку
 
+Вместо имени архива можно указать "-" — архив будет записан в
+стандартный вывод. Файл "-" означает стандартный ввод, он сохраняется
+как член архива с именем "-". Большие архивы и файлы больше 4 ГБ
+записываются в формате Zip64.
+
+Шаблон без "/" сравнивается с именем файла в любой директории, шаблон
+с "/" — с полным относительным путем; "**" соответствует любому числу
+директорий. Исключенная директория пропускается вместе с содержимым.
+
+Ведущие "/", "./" и "../" из имен членов отбрасываются, поэтому архив
+не распакуется за пределы целевой директории.
+
+Неизмененные члены при -u, -f и -d копируются без перепаковки,
+архив заменяется атомарно через временный файл.
+
 Примеры:
   zip archive.zip file1.txt file2.txt
   zip -r archive.zip directory/
-  zip -e "*.tmp" archive.zip *.txt
-  zip -r -e "*.log" archive.zip logs/
-  zip -q silent.zip file1 file2`)
+  zip -x "*.tmp" archive.zip *.txt
+  zip -r -x "*.log" archive.zip logs/
+  zip -r -x "build/**/*.o" -x@exclude.lst src.zip build/ vendor/
+  zip -r -i "*.go" --gitignore code.zip project/
+  zip -q silent.zip file1 file2
+  zip -u -r archive.zip directory/
+  zip -d "*.log" archive.zip
+  zip -r -9 -n .jpg:.png:.gz -v site.zip public/
+  pg_dump mydb | zip dump.zip -
+  zip -r - directory/ | ssh host "cat > backup.zip"
+  git describe | zip -z -r release.zip dist/
+  zip -r -comment-file BUILD -c notes.tsv release.zip dist/
+  zip -r -s 2g backup.zip data/
+  zip -j flat.zip build/bin/* build/lib/*.so
+  zip -r --root /srv/site site.zip /srv/site/public
+  zip -r -e -encryption aes256 secret.zip docs/
+  ZIP_PASSWORD=secret zip -r -password-env ZIP_PASSWORD backup.zip data/`)
+}
+
+// zipOptions — параметры создания архива
+type zipOptions struct {
+	recursive     bool
+	quiet         bool
+	verbose       bool
+	symlinks      bool
+	filter        pathFilter
+	comment       string            // комментарий архива (-z, -comment-file)
+	comments      map[string]string // комментарии членов по именам (-c)
+	encryption    encryptionMethod
+	password      string
+	level         int
+	jobs          int
+	junkPaths     bool   // -j: только имена файлов
+	root          string // --root: абсолютный путь корня для имен членов
+	splitSize     int64  // размер части архива (-s), 0 — один файл
+	storeSuffixes []string
+	report        *entryReport
+	log           io.Writer // куда выводятся сообщения о ходе работы
+}
+
+// stat возвращает сведения о файле; с -y символическая ссылка
+// описывает саму себя, а не свою цель
+func (o *zipOptions) stat(path string) (os.FileInfo, error) {
+	if o.symlinks {
+		return os.Lstat(path)
+	}
+	return os.Stat(path)
+}
+
+// storeOnly сообщает, нужно ли сохранить файл без сжатия
+func (o *zipOptions) storeOnly(name string) bool {
+	if o.level == 0 {
+		return true
+	}
+	lower := strings.ToLower(name)
+	for _, suffix := range o.storeSuffixes {
+		if strings.HasSuffix(lower, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// entryComment возвращает комментарий члена архива из файла -c
+func (o *zipOptions) entryComment(name string) string {
+	return o.comments[strings.TrimSuffix(name, "/")]
+}
+
+// readArchiveComment читает комментарий архива из файла или, если имя
+// не задано, из стандартного ввода
+func readArchiveComment(filename string) (string, error) {
+	var data []byte
+	var err error
+	if filename == "" {
+		if stat, statErr := os.Stdin.Stat(); statErr == nil && stat.Mode()&os.ModeCharDevice != 0 {
+			fmt.Fprintln(os.Stderr, "Введите комментарий архива (завершите Ctrl+D):")
+		}
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(filename)
+	}
+	if err != nil {
+		return "", fmt.Errorf("не удалось прочитать комментарий архива: %v", err)
+	}
+
+	comment := strings.TrimRight(string(data), "\r\n")
+	if len(comment) > maxCommentLen {
+		return "", fmt.Errorf("комментарий архива длиннее %d байт", maxCommentLen)
+	}
+	return comment, nil
+}
+
+// loadEntryComments читает комментарии членов архива: в каждой строке
+// имя члена и комментарий через табуляцию, "\n" в комментарии — перевод
+// строки. Пустые строки и строки, начинающиеся с #, пропускаются.
+func loadEntryComments(filename string) (map[string]string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать файл комментариев: %v", err)
+	}
+
+	comments := make(map[string]string)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, comment, ok := strings.Cut(line, "\t")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%s:%d: ожидается имя и комментарий через табуляцию", filename, i+1)
+		}
+		comment = strings.ReplaceAll(comment, `\n`, "\n")
+		if len(comment) > maxCommentLen {
+			return nil, fmt.Errorf("%s:%d: комментарий длиннее %d байт", filename, i+1, maxCommentLen)
+		}
+		name = strings.TrimSuffix(strings.TrimPrefix(filepath.ToSlash(name), "./"), "/")
+		comments[name] = comment
+	}
+	return comments, nil
+}
+
+// maxCommentLen — предельная длина комментария в формате ZIP
+const maxCommentLen = 0xffff
+
+// entryReport — член архива, для которого после сжатия нужно вывести
+// строку со степенью сжатия. zip.Writer закрывает компрессор члена
+// только при переходе к следующему члену, поэтому строку печатает
+// сам компрессор при закрытии.
+type entryReport struct {
+	name string
+}
+
+// registerCompressors подключает к архиву компрессоры с выбранным
+// уровнем сжатия, которые считают размеры для подробного вывода
+func registerCompressors(zipWriter *zip.Writer, opts *zipOptions) {
+	zipWriter.RegisterCompressor(zip.Deflate, func(w io.Writer) (io.WriteCloser, error) {
+		out := &countingWriter{w: w}
+		fw, err := newFlateWriter(out, opts.level)
+		if err != nil {
+			return nil, err
+		}
+		return &entryCompressor{WriteCloser: fw, out: out, method: zip.Deflate, report: opts.report, log: opts.log}, nil
+	})
+	zipWriter.RegisterCompressor(zip.Store, func(w io.Writer) (io.WriteCloser, error) {
+		out := &countingWriter{w: w}
+		return &entryCompressor{WriteCloser: nopWriteCloser{out}, out: out, method: zip.Store, report: opts.report, log: opts.log}, nil
+	})
+}
+
+// flateWriters хранит компрессоры deflate отдельно для каждого уровня
+// сжатия (от flate.HuffmanOnly до flate.BestCompression): создание
+// flate.Writer выделяет около мегабайта, а членов в архиве могут быть
+// десятки тысяч
+var flateWriters [flate.BestCompression - flate.HuffmanOnly + 1]sync.Pool
+
+// newFlateWriter берет компрессор нужного уровня из пула или создает
+// новый; при закрытии он возвращается в пул
+func newFlateWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	if level < flate.HuffmanOnly || level > flate.BestCompression {
+		return flate.NewWriter(w, level)
+	}
+	if fw, ok := flateWriters[level-flate.HuffmanOnly].Get().(*flate.Writer); ok {
+		fw.Reset(w)
+		return &pooledFlateWriter{Writer: fw, level: level}, nil
+	}
+	fw, err := flate.NewWriter(w, level)
+	if err != nil {
+		return nil, err
+	}
+	return &pooledFlateWriter{Writer: fw, level: level}, nil
+}
+
+// pooledFlateWriter — компрессор из пула flateWriters
+type pooledFlateWriter struct {
+	*flate.Writer
+	level int
+}
+
+func (p *pooledFlateWriter) Close() error {
+	err := p.Writer.Close()
+	flateWriters[p.level-flate.HuffmanOnly].Put(p.Writer)
+	p.Writer = nil
+	return err
+}
+
+// entryCompressor считает исходные и сжатые байты члена архива
+type entryCompressor struct {
+	io.WriteCloser
+	out    *countingWriter
+	in     int64
+	method uint16
+	report *entryReport
+	log    io.Writer
+}
+
+func (c *entryCompressor) Write(p []byte) (int, error) {
+	n, err := c.WriteCloser.Write(p)
+	c.in += int64(n)
+	return n, err
+}
+
+func (c *entryCompressor) Close() error {
+	if err := c.WriteCloser.Close(); err != nil {
+		return err
+	}
+	if c.report.name != "" {
+		fmt.Fprintf(c.log, "  добавлен файл: %s (%s)\n", c.report.name, compressionNote(c.method, c.in, c.out.n))
+		c.report.name = ""
+	}
+	return nil
+}
+
+// compressionNote описывает степень сжатия члена архива
+func compressionNote(method uint16, size, compressed int64) string {
+	if method == zip.Store {
+		return "без сжатия"
+	}
+	ratio := int64(0)
+	if size > 0 && compressed < size {
+		ratio = (size - compressed) * 100 / size
+	}
+	return fmt.Sprintf("сжат на %d%%", ratio)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type nopWriteCloser struct {
+	io.Writer
 }
 
-func createZip(zipName string, files []string, recursive, quiet bool, excludePattern string) error {
-	zipFile, err := os.Create(zipName)
+func (nopWriteCloser) Close() error { return nil }
+
+func createZip(zipName string, files []string, opts zipOptions) error {
+	quiet := opts.quiet
+
+	// Список файлов собирается до создания архива, чтобы конфликты имен
+	// не оставляли недописанный архив
+	paths, skippedCount, err := collectFiles(files, &opts)
 	if err != nil {
-		return fmt.Errorf("не удалось создать архив: %v", err)
+		return err
+	}
+
+	// Архив в стандартном выводе пишется потоком: zip.Writer не требует
+	// перемещения по файлу, размеры членов попадают в дескрипторы данных.
+	// Архив из частей пишется через splitWriter, который сам расставляет
+	// номера частей в центральном каталоге
+	var out io.Writer = os.Stdout
+	var split *splitWriter
+	if opts.splitSize > 0 {
+		split = &splitWriter{name: zipName, limit: opts.splitSize}
+		defer split.discard()
+		out = split
+	} else if zipName != stdioName {
+		zipFile, err := os.Create(zipName)
+		if err != nil {
+			return fmt.Errorf("не удалось создать архив: %v", err)
+		}
+		defer zipFile.Close()
+		out = zipFile
 	}
-	defer zipFile.Close()
 
-	zipWriter := zip.NewWriter(zipFile)
-	defer zipWriter.Close()
+	zipWriter := zip.NewWriter(out)
+	if split != nil {
+		// Смещения отсчитываются с учетом сигнатуры в начале первой части
+		zipWriter.SetOffset(splitMarkerLen)
+	}
+	if err := zipWriter.SetComment(opts.comment); err != nil {
+		return err
+	}
+	registerCompressors(zipWriter, &opts)
 
 	successCount := 0
+
+	// Файлы сжимаются параллельно, а записываются строго в порядке обхода,
+	// поэтому архив не зависит от числа потоков. Член в начале очереди
+	// сжимается прямо в архив, остальные — в буферы; очередь ограничена,
+	// чтобы сжатые данные не накапливались.
+	queue := make(chan chan *preparedEntry, 2*opts.jobs)
+	go func() {
+		workers := make(chan struct{}, opts.jobs)
+		for _, path := range paths {
+			result := make(chan *preparedEntry, 1)
+			queue <- result
+			workers <- struct{}{}
+			go func(path string) {
+				entry := prepareEntry(path, &opts)
+				result <- entry
+				if entry.file != nil {
+					entry.file.run(opts.level)
+				}
+				<-workers
+			}(path)
+		}
+		close(queue)
+	}()
+
+	for result := range queue {
+		entry := <-result
+		path := entry.path
+		err := commitEntry(zipWriter, entry, &opts)
+		if _, ok := err.(*partialEntryError); ok {
+			// Дожидаемся остальных членов, чтобы удалить их временные файлы
+			for result := range queue {
+				if entry := <-result; entry.file != nil {
+					entry.file.discard()
+				}
+			}
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if err != nil {
+			if !quiet {
+				fmt.Fprintf(os.Stderr, "Предупреждение: %s: %v\n", path, err)
+			}
+			continue
+		}
+		successCount++
+	}
+
+	// Закрываем архив: дописываются последний член и центральный каталог
+	if split != nil {
+		if err := zipWriter.Flush(); err != nil {
+			return fmt.Errorf("ошибка записи архива: %v", err)
+		}
+		split.holdTail()
+	}
+	if err := zipWriter.Close(); err != nil {
+		return fmt.Errorf("ошибка записи архива: %v", err)
+	}
+	if split != nil {
+		if err := split.Close(); err != nil {
+			return fmt.Errorf("ошибка записи архива: %v", err)
+		}
+	}
+
+	if successCount == 0 {
+		return fmt.Errorf("не удалось добавить ни одного файла в архив")
+	}
+
+	if !quiet {
+		fmt.Fprintf(opts.log, "Добавлено элементов: %d\n", successCount)
+		if skippedCount > 0 {
+			fmt.Fprintf(opts.log, "Пропущено (исключено): %d\n", skippedCount)
+		}
+		if split != nil {
+			fmt.Fprintf(opts.log, "Частей: %d\n", len(split.starts))
+		}
+	}
+
+	return nil
+}
+
+// preparedEntry — член архива, подготовленный к записи. Обычные файлы
+// сжимаются в рабочем потоке, остальное (директории, ссылки,
+// стандартный ввод) записывается при фиксации.
+type preparedEntry struct {
+	path string
+	file *fileJob
+	err  error
+}
+
+// prepareEntry подготавливает член архива; выполняется в рабочем потоке,
+// который затем сжимает обычный файл
+func prepareEntry(path string, opts *zipOptions) *preparedEntry {
+	entry := &preparedEntry{path: path}
+	if path == stdioName {
+		return entry
+	}
+	info, err := opts.stat(path)
+	if err != nil {
+		entry.err = err
+		return entry
+	}
+	if info.Mode().IsRegular() {
+		entry.file, entry.err = openFileJob(path, info, opts)
+	}
+	return entry
+}
+
+// commitEntry записывает подготовленный член архива
+func commitEntry(zipWriter *zip.Writer, entry *preparedEntry, opts *zipOptions) error {
+	if entry.err != nil {
+		return entry.err
+	}
+	if entry.file == nil {
+		return addToZip(zipWriter, entry.path, opts)
+	}
+	return writeFileJob(zipWriter, entry.file, opts)
+}
+
+// collectFiles обходит указанные файлы и директории и возвращает пути
+// для архивирования в порядке обхода, а также число исключенных. Пути,
+// которые дали бы одинаковые имена членов (например, при -j), — ошибка.
+func collectFiles(files []string, opts *zipOptions) ([]string, int, error) {
+	quiet := opts.quiet
+	var paths []string
 	skippedCount := 0
 
+	// Имена членов → пути, из которых они получены
+	names := make(map[string]string)
+	var duplicates []string
+	add := func(path string, isDir bool) {
+		name := stdioName
+		if path != stdioName {
+			var err error
+			name, err = opts.memberName(path, isDir)
+			if err != nil {
+				if !quiet {
+					fmt.Fprintf(os.Stderr, "Предупреждение: %s: %v\n", path, err)
+				}
+				return
+			}
+			// Корень --root и директории при -j в архив не попадают
+			if name == "" {
+				return
+			}
+		}
+		if first, ok := names[name]; ok {
+			duplicates = append(duplicates, fmt.Sprintf("%s (%s и %s)", name, first, path))
+			return
+		}
+		names[name] = path
+		paths = append(paths, path)
+	}
+
 	// Для каждого файла/директории
 	for _, item := range files {
-		info, err := os.Stat(item)
+		// Стандартный ввод добавляется как член архива с именем "-"
+		if item == stdioName {
+			add(item, false)
+			continue
+		}
+
+		// С -y ссылка в аргументах сохраняется как ссылка, даже висячая
+		info, err := opts.stat(item)
 		if err != nil {
 			if !quiet {
 				fmt.Fprintf(os.Stderr, "Предупреждение: %s: %v\n", item, err)
@@ -101,32 +797,35 @@ func createZip(zipName string, files []string, recursive, quiet bool, excludePat
 			continue
 		}
 
-		if info.IsDir() && recursive {
+		if info.IsDir() && opts.recursive {
 			// Рекурсивный обход директории
 			err = filepath.Walk(item, func(path string, info os.FileInfo, err error) error {
 				if err != nil {
 					return err
 				}
 
-				// Проверяем, не нужно ли исключить этот файл
-				if shouldExclude(path, excludePattern) {
+				// Проверяем правила отбора; исключенная директория
+				// пропускается вместе с содержимым
+				verdict, reason := opts.filter.check(path, info.IsDir())
+				if verdict == excludePath {
 					if !quiet {
-						fmt.Printf("  пропущен (исключен): %s\n", path)
+						fmt.Fprintf(opts.log, "  пропущен (%s): %s\n", reason, path)
 					}
 					skippedCount++
+					if info.IsDir() {
+						return filepath.SkipDir
+					}
 					return nil
 				}
 
-				// Добавляем в архив
-				err = addToZip(zipWriter, path, quiet)
-				if err != nil {
-					if !quiet {
-						fmt.Fprintf(os.Stderr, "Предупреждение: %s: %v\n", path, err)
+				if info.IsDir() {
+					if err := opts.filter.loadGitignore(path); err != nil && !quiet {
+						fmt.Fprintf(os.Stderr, "Предупреждение: %v\n", err)
 					}
-					return nil // Продолжаем обход
 				}
-
-				successCount++
+				if verdict == keepPath {
+					add(path, info.IsDir())
+				}
 				return nil
 			})
 
@@ -134,137 +833,1954 @@ func createZip(zipName string, files []string, recursive, quiet bool, excludePat
 				fmt.Fprintf(os.Stderr, "Предупреждение: ошибка обхода %s: %v\n", item, err)
 			}
 		} else {
-			// Проверяем, не нужно ли исключить этот файл
-			if shouldExclude(item, excludePattern) {
-				if !quiet {
-					fmt.Printf("  пропущен (исключен): %s\n", item)
+			// Проверяем правила отбора
+			if verdict, reason := opts.filter.check(item, info.IsDir()); verdict != keepPath {
+				if !quiet && verdict == excludePath {
+					fmt.Fprintf(opts.log, "  пропущен (%s): %s\n", reason, item)
 				}
 				skippedCount++
 				continue
 			}
 
 			// Простой файл или директория без рекурсии
-			err = addToZip(zipWriter, item, quiet)
-			if err != nil {
-				if !quiet {
-					fmt.Fprintf(os.Stderr, "Предупреждение: %s: %v\n", item, err)
-				}
-				continue
-			}
-			successCount++
+			add(item, info.IsDir())
 		}
 	}
 
-	if successCount == 0 {
-		return fmt.Errorf("не удалось добавить ни одного файла в архив")
-	}
-
-	if !quiet {
-		fmt.Printf("Добавлено элементов: %d\n", successCount)
-		if skippedCount > 0 {
-			fmt.Printf("Пропущено (исключено): %d\n", skippedCount)
-		}
+	if len(duplicates) > 0 {
+		return nil, 0, fmt.Errorf("одинаковые имена членов архива:\n  %s", strings.Join(duplicates, "\n  "))
 	}
-
-	return nil
+	return paths, skippedCount, nil
 }
 
-// shouldExclude проверяет, нужно ли исключить файл по шаблону
-func shouldExclude(path string, pattern string) bool {
-	if pattern == "" {
-		return false
-	}
+// updateMode — способ изменения существующего архива
+type updateMode int
 
-	// Получаем только имя файла (без пути)
-	filename := filepath.Base(path)
+const (
+	modeUpdate  updateMode = iota // -u: добавить новые и измененные файлы
+	modeFreshen                   // -f: обновить только уже имеющиеся
+	modeDelete                    // -d: удалить члены по шаблонам
+)
 
-	// Проверяем соответствие шаблону
-	matched, err := filepath.Match(pattern, filename)
-	if err != nil {
-		// Если ошибка в шаблоне, просто не исключаем
-		return false
-	}
+// updateZip изменяет существующий архив. Неизмененные члены переносятся
+// в новый архив без перепаковки (zip.Writer.Copy), новый архив пишется
+// во временный файл рядом и атомарно заменяет старый.
+func updateZip(zipName string, files []string, opts zipOptions, mode updateMode, deletePatterns []string) error {
+	quiet := opts.quiet
 
-	return matched
-}
+	if isSplitArchive(zipName) {
+		return fmt.Errorf("изменение архивов из частей (-s) не поддерживается")
+	}
 
-func addToZip(zipWriter *zip.Writer, path string, quiet bool) error {
-	// Получаем информацию о файле/директории
-	info, err := os.Stat(path)
+	reader, err := zip.OpenReader(zipName)
 	if err != nil {
-		return err
+		if os.IsNotExist(err) && mode == modeUpdate {
+			// Обновлять нечего — просто создаем архив
+			return createZip(zipName, files, opts)
+		}
+		return fmt.Errorf("не удалось открыть архив: %v", err)
 	}
+	defer reader.Close()
 
-	// Если это директория
-	if info.IsDir() {
-		return addDirectoryToZip(zipWriter, path, info, quiet)
+	// Права нового архива берем у старого
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(zipName); err == nil {
+		perm = info.Mode().Perm()
 	}
 
-	// Если это обычный файл
-	return addFileToZip(zipWriter, path, info, quiet)
-}
-
-func addFileToZip(zipWriter *zip.Writer, filename string, info os.FileInfo, quiet bool) error {
-	// Открываем файл
-	file, err := os.Open(filename)
+	tmp, err := os.CreateTemp(filepath.Dir(zipName), ".zip-update-*")
 	if err != nil {
-		return err
+		return fmt.Errorf("не удалось создать временный файл: %v", err)
 	}
-	defer file.Close()
+	committed := false
+	defer func() {
+		if !committed {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
 
-	// Создаем заголовок файла в архиве
-	header, err := zip.FileInfoHeader(info)
-	if err != nil {
+	zipWriter := zip.NewWriter(tmp)
+	// Новый комментарий архива заменяет старый
+	comment := reader.Comment
+	if opts.comment != "" {
+		comment = opts.comment
+	}
+	if err := zipWriter.SetComment(comment); err != nil {
 		return err
 	}
+	registerCompressors(zipWriter, &opts)
 
-	// Устанавливаем имя файла в архиве
-	header.Name = filename
+	// Замененные члены сохраняют свои комментарии, если -c не задает новые
+	comments := make(map[string]string)
+	for _, f := range reader.File {
+		if f.Comment != "" {
+			comments[strings.TrimSuffix(f.Name, "/")] = f.Comment
+		}
+	}
+	for name, text := range opts.comments {
+		comments[name] = text
+	}
+	opts.comments = comments
 
-	// Устанавливаем метод сжатия (Deflate по умолчанию)
-	header.Method = zip.Deflate
+	// Файлы с диска, сопоставленные с именами членов архива
+	candidates := make(map[string]string)
+	var order []string
+	if mode != modeDelete {
+		paths, _, err := collectFiles(files, &opts)
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			name, err := opts.memberName(path, isDirPath(path, &opts))
+			if err != nil || name == "" {
+				continue
+			}
+			if _, ok := candidates[name]; !ok {
+				order = append(order, name)
+			}
+			candidates[name] = path
+		}
+		// -f без списка файлов обновляет все члены архива
+		if mode == modeFreshen && len(files) == 0 {
+			for _, f := range reader.File {
+				if !strings.HasSuffix(f.Name, "/") {
+					candidates[f.Name] = filepath.Join(opts.root, filepath.FromSlash(f.Name))
+				}
+			}
+		}
+	}
 
-	// Создаем запись в архиве
-	writer, err := zipWriter.CreateHeader(header)
-	if err != nil {
+	updated, added, deleted, kept := 0, 0, 0, 0
+	inArchive := make(map[string]bool, len(reader.File))
+
+	for _, f := range reader.File {
+		inArchive[f.Name] = true
+
+		if mode == modeDelete && matchesAny(f.Name, deletePatterns) {
+			if !quiet {
+				fmt.Fprintf(opts.log, "  удален: %s\n", f.Name)
+			}
+			deleted++
+			continue
+		}
+
+		// Заменяем член, если файл на диске новее
+		if path, ok := candidates[f.Name]; ok && !strings.HasSuffix(f.Name, "/") {
+			if info, err := opts.stat(path); err == nil && isNewer(info, f) {
+				replaceOpts := opts
+				replaceOpts.quiet = true
+				replaceOpts.verbose = false
+				if err := addToZip(zipWriter, path, &replaceOpts); err != nil {
+					return fmt.Errorf("%s: %v", path, err)
+				}
+				if !quiet {
+					fmt.Fprintf(opts.log, "  обновлен: %s\n", f.Name)
+				}
+				updated++
+				continue
+			}
+		}
+
+		// Остальное копируем как есть, без распаковки и сжатия;
+		// меняется только комментарий, если он задан в -c
+		f.Comment = opts.entryComment(f.Name)
+		if hasNonASCII(f.Comment) {
+			f.Flags |= zipFlagUTF8
+		}
+		if err := zipWriter.Copy(f); err != nil {
+			return fmt.Errorf("не удалось скопировать %s: %v", f.Name, err)
+		}
+		kept++
+	}
+
+	// В режиме -u дописываем файлы, которых в архиве не было
+	if mode == modeUpdate {
+		for _, name := range order {
+			if inArchive[name] {
+				continue
+			}
+			path := candidates[name]
+			if err := addToZip(zipWriter, path, &opts); err != nil {
+				if _, ok := err.(*partialEntryError); ok {
+					return fmt.Errorf("%s: %v", path, err)
+				}
+				if !quiet {
+					fmt.Fprintf(os.Stderr, "Предупреждение: %s: %v\n", path, err)
+				}
+				continue
+			}
+			added++
+		}
+	}
+
+	if err := zipWriter.Close(); err != nil {
+		return fmt.Errorf("ошибка записи архива: %v", err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
 		return err
 	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("ошибка записи архива: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), zipName); err != nil {
+		return fmt.Errorf("не удалось заменить архив: %v", err)
+	}
+	committed = true
+
+	if !quiet {
+		switch mode {
+		case modeDelete:
+			fmt.Fprintf(opts.log, "Удалено: %d, осталось: %d\n", deleted, kept)
+		default:
+			fmt.Fprintf(opts.log, "Обновлено: %d, добавлено: %d, без изменений: %d\n", updated, added, kept)
+		}
+	}
+	if mode == modeDelete && deleted == 0 {
+		return fmt.Errorf("ни один член архива не подходит под шаблоны: %s", strings.Join(deletePatterns, ", "))
+	}
+
+	return nil
+}
+
+// isNewer сообщает, изменился ли файл на диске после записи в архив.
+// Время сравнивается с точностью до секунды, как оно хранится в архиве.
+func isNewer(info os.FileInfo, f *zip.File) bool {
+	if info.ModTime().Truncate(time.Second).After(f.Modified) {
+		return true
+	}
+	return info.Mode().IsRegular() && uint64(info.Size()) != f.UncompressedSize64
+}
+
+func isDirPath(path string, opts *zipOptions) bool {
+	info, err := opts.stat(path)
+	return err == nil && info.IsDir()
+}
+
+// memberName возвращает имя члена архива для пути на диске. При -j
+// остается только имя файла, а директории не сохраняются; при --root путь
+// берется относительно корня, и путь вне корня — ошибка. Ведущие "/",
+// "./" и "../" отбрасываются, чтобы имя не указывало за пределы места
+// распаковки. Пустое имя означает, что путь в архив не попадает.
+func (o *zipOptions) memberName(path string, isDir bool) (string, error) {
+	if o.junkPaths {
+		if isDir {
+			return "", nil
+		}
+		return filepath.Base(path), nil
+	}
+
+	if o.root != "" {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return "", err
+		}
+		rel, err := filepath.Rel(o.root, abs)
+		if err != nil {
+			return "", err
+		}
+		if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", fmt.Errorf("путь вне корня %s", o.root)
+		}
+		path = rel
+	}
+
+	name := strings.TrimLeft(filepath.ToSlash(filepath.Clean(path)), "/")
+	for name == ".." || strings.HasPrefix(name, "../") {
+		name = strings.TrimPrefix(name[2:], "/")
+	}
+	if name == "" || name == "." {
+		return "", nil
+	}
+	if isDir {
+		name += "/"
+	}
+	return name, nil
+}
+
+// matchesAny проверяет имя члена архива по шаблонам удаления: шаблон
+// сравнивается с полным именем и с именем файла, а имя директории
+// захватывает и ее содержимое
+func matchesAny(name string, patterns []string) bool {
+	trimmed := strings.TrimSuffix(name, "/")
+	for _, pattern := range patterns {
+		pattern = filepath.ToSlash(pattern)
+		if ok, _ := path.Match(pattern, trimmed); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(trimmed)); ok {
+			return true
+		}
+		if dir := strings.TrimSuffix(pattern, "/"); dir != "" && strings.HasPrefix(trimmed, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// stringList — флаг, который можно указать несколько раз
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// splitListFileArgs разделяет слитную запись -x@файл и -i@файл на флаг
+// и значение: пакет flag не отделяет значение без "="
+func splitListFileArgs(args []string) []string {
+	var result []string
+	for _, arg := range args {
+		if len(arg) > 3 && (strings.HasPrefix(arg, "-x@") || strings.HasPrefix(arg, "-i@")) {
+			result = append(result, arg[:2], arg[2:])
+			continue
+		}
+		result = append(result, arg)
+	}
+	return result
+}
+
+// loadPatterns собирает шаблоны -x или -i; значение "@файл" заменяется
+// строками файла (пустые строки и комментарии # пропускаются)
+func loadPatterns(values []string) ([]string, error) {
+	var patterns []string
+	for _, value := range values {
+		if !strings.HasPrefix(value, "@") {
+			patterns = append(patterns, value)
+			continue
+		}
+		data, err := os.ReadFile(value[1:])
+		if err != nil {
+			return nil, fmt.Errorf("не удалось прочитать список шаблонов %s: %v", value[1:], err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				patterns = append(patterns, line)
+			}
+		}
+	}
+
+	// Проверяем корректность шаблонов заранее
+	for _, pattern := range patterns {
+		if _, err := path.Match(filepath.ToSlash(pattern), ""); err != nil {
+			return nil, fmt.Errorf("неверный шаблон %q: %v", pattern, err)
+		}
+	}
+	return patterns, nil
+}
+
+// filterVerdict — решение правил отбора для пути
+type filterVerdict int
+
+const (
+	keepPath    filterVerdict = iota // добавить в архив
+	skipEntry                        // не добавлять, но обходить содержимое
+	excludePath                      // исключить вместе с содержимым
+)
+
+// pathFilter — правила отбора файлов: шаблоны -x и -i и, при
+// --gitignore, правила из файлов .gitignore, найденных при обходе.
+// Шаблон без "/" сравнивается с именем файла, шаблон с "/" — с полным
+// относительным путем; "**" соответствует любому числу директорий.
+type pathFilter struct {
+	exclude   []string
+	include   []string
+	gitignore bool
+	ignores   map[string][]ignoreRule // директория → правила ее .gitignore
+}
+
+// check решает, добавлять ли путь в архив, и возвращает причину пропуска
+func (f *pathFilter) check(name string, isDir bool) (filterVerdict, string) {
+	name = path.Clean(filepath.ToSlash(name))
+
+	for _, pattern := range f.exclude {
+		if matchPattern(pattern, name) {
+			return excludePath, "исключен"
+		}
+	}
+	if f.ignored(name, isDir) {
+		return excludePath, "исключен .gitignore"
+	}
+
+	// При -i директории обходятся, но сами добавляются, только если
+	// подходят под шаблон
+	if len(f.include) == 0 {
+		return keepPath, ""
+	}
+	for _, pattern := range f.include {
+		if matchPattern(pattern, name) {
+			return keepPath, ""
+		}
+	}
+	if isDir {
+		return skipEntry, ""
+	}
+	return excludePath, "не подходит под -i"
+}
+
+// matchPattern сравнивает путь с шаблоном -x или -i
+func matchPattern(pattern, name string) bool {
+	pattern = strings.TrimPrefix(filepath.ToSlash(pattern), "./")
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(name))
+		return ok
+	}
+	return matchGlob(pattern, name)
+}
+
+// matchGlob сравнивает путь с шаблоном по сегментам; сегмент "**"
+// соответствует любому числу сегментов, в том числе нулю
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// ignoreRule — правило из файла .gitignore
+type ignoreRule struct {
+	pattern  string
+	negate   bool // "!": вернуть ранее исключенный путь
+	dirOnly  bool // завершающий "/": только директории
+	anchored bool // содержит "/": путь от директории .gitignore
+}
 
-	// Копируем содержимое файла в архив
-	_, err = io.Copy(writer, file)
+// loadGitignore читает .gitignore директории, если он есть
+func (f *pathFilter) loadGitignore(dir string) error {
+	if !f.gitignore {
+		return nil
+	}
+	data, err := os.ReadFile(filepath.Join(dir, ".gitignore"))
+	if os.IsNotExist(err) {
+		return nil
+	}
 	if err != nil {
 		return err
 	}
 
-	if !quiet {
-		fmt.Printf("  добавлен файл: %s\n", filename)
+	var rules []ignoreRule
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r ")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var rule ignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		rule.anchored = strings.Contains(line, "/")
+		rule.pattern = strings.TrimPrefix(line, "/")
+		if _, err := path.Match(rule.pattern, ""); err != nil || rule.pattern == "" {
+			continue
+		}
+		rules = append(rules, rule)
 	}
 
+	if f.ignores == nil {
+		f.ignores = make(map[string][]ignoreRule)
+	}
+	f.ignores[path.Clean(filepath.ToSlash(dir))] = rules
 	return nil
 }
 
-func addDirectoryToZip(zipWriter *zip.Writer, dirname string, info os.FileInfo, quiet bool) error {
-	// Для директории создаем запись с / в конце
-	header := &zip.FileHeader{
-		Name:     dirname + "/", // Директории должны заканчиваться на /
-		Modified: info.ModTime(),
+// ignored проверяет путь по правилам .gitignore родительских директорий:
+// от внешних к внутренним, побеждает последнее подходящее правило
+func (f *pathFilter) ignored(name string, isDir bool) bool {
+	if len(f.ignores) == 0 {
+		return false
 	}
 
-	// Устанавливаем права доступа
-	header.SetMode(info.Mode())
+	var dirs []string
+	for dir := path.Dir(name); ; dir = path.Dir(dir) {
+		dirs = append(dirs, dir)
+		if dir == "." || dir == "/" {
+			break
+		}
+	}
 
-	// Метод сжатия для директорий всегда Store (без сжатия)
-	header.Method = zip.Store
+	ignored := false
+	for i := len(dirs) - 1; i >= 0; i-- {
+		rules, ok := f.ignores[dirs[i]]
+		if !ok {
+			continue
+		}
+		rel := name
+		if dirs[i] != "." {
+			rel = strings.TrimPrefix(strings.TrimPrefix(name, dirs[i]), "/")
+		}
+		for _, rule := range rules {
+			if rule.dirOnly && !isDir {
+				continue
+			}
+			target := rel
+			if !rule.anchored {
+				target = path.Base(rel)
+			}
+			if matchGlob(rule.pattern, target) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
 
-	// Создаем запись директории
-	_, err := zipWriter.CreateHeader(header)
+func addToZip(zipWriter *zip.Writer, path string, opts *zipOptions) error {
+	if path == stdioName {
+		return addStdinToZip(zipWriter, opts)
+	}
+
+	// Получаем информацию о файле/директории
+	info, err := opts.stat(path)
 	if err != nil {
 		return err
 	}
 
-	if !quiet {
-		fmt.Printf("  добавлена директория: %s/\n", dirname)
+	// Если это директория
+	if info.IsDir() {
+		return addDirectoryToZip(zipWriter, path, info, opts)
+	}
+
+	// Символическая ссылка (только с -y)
+	if info.Mode()&os.ModeSymlink != 0 {
+		return addSymlinkToZip(zipWriter, path, info, opts)
+	}
+
+	// Если это обычный файл
+	return addFileToZip(zipWriter, path, info, opts)
+}
+
+func addFileToZip(zipWriter *zip.Writer, filename string, info os.FileInfo, opts *zipOptions) error {
+	job, err := openFileJob(filename, info, opts)
+	if err != nil {
+		return err
+	}
+	go job.run(opts.level)
+	return writeFileJob(zipWriter, job, opts)
+}
+
+// fileJob — сжатие обычного файла или стандартного ввода. Пока очередь
+// записи не дошла до члена, сжатые данные копятся в буфере; когда дошла,
+// накопленное переносится в архив, а остальное пишется прямо в архив.
+// Поэтому буфер (и временный файл) нужен только членам, которые ждут
+// записи предыдущих.
+type fileJob struct {
+	path   string
+	header *zip.FileHeader
+	method uint16
+	src    io.ReadCloser
+
+	mu         sync.Mutex
+	buf        spool
+	direct     io.Writer
+	compressed int64
+
+	done chan struct{}
+	crc  uint32
+	size int64
+	err  error
+}
+
+func newFileJob(path string, header *zip.FileHeader, src io.ReadCloser) *fileJob {
+	return &fileJob{path: path, header: header, method: header.Method, src: src, done: make(chan struct{})}
+}
+
+// openFileJob открывает файл и готовит заголовок его члена архива.
+// Не пишет в архив, поэтому может выполняться параллельно.
+func openFileJob(filename string, info os.FileInfo, opts *zipOptions) (*fileJob, error) {
+	// Открываем файл
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// Создаем заголовок файла в архиве
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	// Устанавливаем имя файла в архиве
+	header.Name, err = opts.memberName(filename, false)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	header.Comment = opts.entryComment(header.Name)
+	setUnixExtra(header, info)
+
+	// Устанавливаем метод сжатия (Deflate по умолчанию); уже сжатые
+	// форматы из списка -n, все файлы при -0 и пустые файлы (как в
+	// Info-ZIP) сохраняются как есть
+	header.Method = zip.Deflate
+	if info.Size() == 0 || opts.storeOnly(filename) {
+		header.Method = zip.Store
+	}
+
+	return newFileJob(filename, header, file), nil
+}
+
+// run сжимает данные члена, попутно считая CRC исходных данных
+func (j *fileJob) run(level int) {
+	defer close(j.done)
+	defer j.src.Close()
+
+	crc := crc32.NewIEEE()
+	var compressor io.WriteCloser = nopWriteCloser{j}
+	if j.method == zip.Deflate {
+		fw, err := newFlateWriter(j, level)
+		if err != nil {
+			j.err = err
+			return
+		}
+		compressor = fw
+	}
+	j.size, j.err = io.Copy(compressor, io.TeeReader(j.src, crc))
+	if err := compressor.Close(); j.err == nil {
+		j.err = err
+	}
+	j.crc = crc.Sum32()
+}
+
+func (j *fileJob) Write(p []byte) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var n int
+	var err error
+	if j.direct != nil {
+		n, err = j.direct.Write(p)
+	} else {
+		n, err = j.buf.Write(p)
+	}
+	j.compressed += int64(n)
+	return n, err
+}
+
+// attach переносит накопленные сжатые данные в w и направляет туда
+// все следующие
+func (j *fileJob) attach(w io.Writer) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	data, err := j.buf.reader()
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, data); err != nil {
+		return err
+	}
+	j.direct = w
+	return j.buf.Close()
+}
+
+// discard дожидается конца сжатия и освобождает буфер
+func (j *fileJob) discard() {
+	<-j.done
+	j.buf.Close()
+}
+
+// partialEntryError — ошибка после начала записи члена: его часть уже
+// в архиве, и продолжать запись архива нельзя
+type partialEntryError struct {
+	err error
+}
+
+func (e *partialEntryError) Error() string {
+	return e.err.Error()
+}
+
+// writeFileJob записывает член архива через CreateRaw с дескриптором
+// данных: CRC и размеры известны только после сжатия и попадают
+// в дескриптор и центральный каталог. Член, который не удалось сжать
+// до начала записи, пропускается; ошибка после начала записи
+// возвращается как partialEntryError.
+func writeFileJob(zipWriter *zip.Writer, job *fileJob, opts *zipOptions) error {
+	defer job.discard()
+
+	select {
+	case <-job.done:
+		if job.err != nil {
+			return job.err
+		}
+	default:
+	}
+
+	header := job.header
+	prepareRawHeader(header)
+	header.Flags |= zipFlagDescriptor
+	if opts.encryption != encryptNone {
+		prepareEncryptedHeader(header, opts.encryption)
+	}
+
+	// Зашифрованные файлы шифруются при записи
+	var enc *entryEncryptor
+	w, err := zipWriter.CreateRaw(header)
+	if err == nil && opts.encryption != encryptNone {
+		enc, err = newEntryEncryptor(w, header, opts)
+		w = enc
+	}
+	if err == nil {
+		err = job.attach(w)
+	}
+	<-job.done
+	if err == nil {
+		err = job.err
+	}
+	if err == nil && enc != nil {
+		err = enc.finish()
+	}
+	if err != nil {
+		return &partialEntryError{err}
+	}
+
+	// Заголовок хранится в zip.Writer по указателю: дескриптор данных
+	// и центральный каталог будут записаны с этими значениями. Короткий
+	// дескриптор (членов меньше 4 ГБ) берет 32-битные поля, поэтому
+	// заполняются и они
+	header.CRC32 = job.crc
+	header.UncompressedSize64 = uint64(job.size)
+	header.CompressedSize64 = uint64(job.compressed)
+	if enc != nil {
+		header.CompressedSize64 += uint64(enc.overhead)
+	}
+	header.UncompressedSize = uint32(min(header.UncompressedSize64, uint32max))
+	header.CompressedSize = uint32(min(header.CompressedSize64, uint32max))
+	if header.Method == methodAES {
+		// В AE-2 CRC не записывается, целостность проверяется по HMAC
+		header.CRC32 = 0
+	}
+
+	if opts.encryption != encryptNone {
+		if opts.verbose {
+			fmt.Fprintf(opts.log, "  добавлен файл: %s (зашифрован %s, %s)\n", job.path, opts.encryption,
+				compressionNote(job.method, job.size, job.compressed))
+		} else if !opts.quiet {
+			fmt.Fprintf(opts.log, "  добавлен файл: %s (зашифрован %s)\n", job.path, opts.encryption)
+		}
+		return nil
+	}
+
+	if opts.verbose {
+		fmt.Fprintf(opts.log, "  добавлен файл: %s (%s)\n", job.path, compressionNote(job.method, job.size, job.compressed))
+	} else if !opts.quiet {
+		fmt.Fprintf(opts.log, "  добавлен файл: %s\n", job.path)
 	}
 
 	return nil
 }
+
+// spoolMemoryLimit — сколько сжатых данных члена держится в памяти;
+// больше — переносится во временный файл
+const spoolMemoryLimit = 4 << 20
+
+// spool — буфер для сжатых данных члена архива: в памяти, а при
+// превышении spoolMemoryLimit — во временном файле
+type spool struct {
+	mem  bytes.Buffer
+	file *os.File
+	size int64
+}
+
+func (s *spool) Write(p []byte) (int, error) {
+	if s.file == nil && s.mem.Len()+len(p) > spoolMemoryLimit {
+		file, err := os.CreateTemp("", "zip-spool-*")
+		if err != nil {
+			return 0, fmt.Errorf("не удалось создать временный файл: %v", err)
+		}
+		s.file = file
+		if _, err := s.file.Write(s.mem.Bytes()); err != nil {
+			return 0, err
+		}
+		s.mem = bytes.Buffer{}
+	}
+
+	var n int
+	var err error
+	if s.file != nil {
+		n, err = s.file.Write(p)
+	} else {
+		n, err = s.mem.Write(p)
+	}
+	s.size += int64(n)
+	return n, err
+}
+
+// reader возвращает накопленные данные с начала
+func (s *spool) reader() (io.Reader, error) {
+	if s.file == nil {
+		return bytes.NewReader(s.mem.Bytes()), nil
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return s.file, nil
+}
+
+// Close освобождает буфер и удаляет временный файл
+func (s *spool) Close() error {
+	s.mem = bytes.Buffer{}
+	if s.file == nil {
+		return nil
+	}
+	file := s.file
+	s.file = nil
+	file.Close()
+	return os.Remove(file.Name())
+}
+
+func addDirectoryToZip(zipWriter *zip.Writer, dirname string, info os.FileInfo, opts *zipOptions) error {
+	// Для директории создаем запись с / в конце
+	name, err := opts.memberName(dirname, true)
+	if err != nil {
+		return err
+	}
+	header := &zip.FileHeader{Name: name}
+	header.Comment = opts.entryComment(header.Name)
+
+	// Устанавливаем права доступа, время и владельца
+	header.SetMode(info.Mode())
+	setUnixExtra(header, info)
+
+	// Метод сжатия для директорий всегда Store (без сжатия)
+	header.Method = zip.Store
+
+	// Создаем запись директории
+	_, err = zipWriter.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	if !opts.quiet {
+		fmt.Fprintf(opts.log, "  добавлена директория: %s/\n", dirname)
+	}
+
+	return nil
+}
+
+// addStdinToZip добавляет содержимое стандартного ввода как член "-".
+// Данные сжимаются потоком, без промежуточного файла.
+func addStdinToZip(zipWriter *zip.Writer, opts *zipOptions) error {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return err
+	}
+
+	header := &zip.FileHeader{Name: stdioName, Method: zip.Deflate, Comment: opts.entryComment(stdioName)}
+	if opts.storeOnly(stdioName) {
+		header.Method = zip.Store
+	}
+	header.SetMode(0644)
+	setUnixExtra(header, info)
+
+	if opts.encryption != encryptNone {
+		job := newFileJob(stdioName, header, io.NopCloser(os.Stdin))
+		jobOpts := *opts
+		jobOpts.quiet = true
+		jobOpts.verbose = false
+		go job.run(opts.level)
+		if err := writeFileJob(zipWriter, job, &jobOpts); err != nil {
+			return err
+		}
+		if !opts.quiet {
+			fmt.Fprintf(opts.log, "  добавлен файл: - (стандартный ввод, зашифрован %s)\n", opts.encryption)
+		}
+		return nil
+	}
+
+	writer, err := zipWriter.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	if opts.verbose {
+		opts.report.name = stdioName
+	}
+	if _, err := io.Copy(writer, os.Stdin); err != nil {
+		return err
+	}
+
+	if !opts.quiet && !opts.verbose {
+		fmt.Fprintln(opts.log, "  добавлен файл: - (стандартный ввод)")
+	}
+	return nil
+}
+
+// addSymlinkToZip сохраняет символическую ссылку: как в Info-ZIP,
+// данными члена архива служит путь, на который она указывает
+func addSymlinkToZip(zipWriter *zip.Writer, linkname string, info os.FileInfo, opts *zipOptions) error {
+	target, err := os.Readlink(linkname)
+	if err != nil {
+		return err
+	}
+
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name, err = opts.memberName(linkname, false)
+	if err != nil {
+		return err
+	}
+	header.Comment = opts.entryComment(header.Name)
+	header.Method = zip.Store
+	setUnixExtra(header, info)
+
+	// Путь цели шифруется так же, как данные файлов
+	if opts.encryption != encryptNone {
+		job := newFileJob(linkname, header, io.NopCloser(strings.NewReader(target)))
+		jobOpts := *opts
+		jobOpts.quiet = true
+		jobOpts.verbose = false
+		go job.run(opts.level)
+		if err := writeFileJob(zipWriter, job, &jobOpts); err != nil {
+			return err
+		}
+		if !opts.quiet {
+			fmt.Fprintf(opts.log, "  добавлена ссылка: %s (зашифрована %s)\n", linkname, opts.encryption)
+		}
+		return nil
+	}
+
+	writer, err := zipWriter.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(writer, target); err != nil {
+		return err
+	}
+
+	if !opts.quiet {
+		fmt.Fprintf(opts.log, "  добавлена ссылка: %s -> %s\n", linkname, target)
+	}
+
+	return nil
+}
+
+// Дополнительные поля Info-ZIP для Unix
+const (
+	extTimeExtraID = 0x5455 // расширенная метка времени
+	unixExtraID    = 0x7875 // владелец и группа (Info-ZIP Unix, версия 3)
+)
+
+// setUnixExtra записывает время модификации с точностью до секунды
+// (0x5455) и uid/gid владельца (0x7875). Modified обнуляется, чтобы
+// zip.Writer не добавил вторую метку времени. Время доступа не
+// сохраняется: zip.Writer пишет одно и то же поле и в локальный
+// заголовок, и в центральный каталог, где Info-ZIP допускает только
+// время модификации, а чтение файла при архивации меняет atime, и
+// архивы одних и тех же файлов различались бы.
+func setUnixExtra(header *zip.FileHeader, info os.FileInfo) {
+	mtime := info.ModTime()
+	header.ModifiedDate, header.ModifiedTime = msDosTime(mtime)
+	header.Modified = time.Time{}
+
+	var extra []byte
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		owner := make([]byte, 15)
+		binary.LittleEndian.PutUint16(owner[0:], unixExtraID)
+		binary.LittleEndian.PutUint16(owner[2:], 11)
+		owner[4] = 1 // версия
+		owner[5] = 4 // размер uid
+		binary.LittleEndian.PutUint32(owner[6:], st.Uid)
+		owner[10] = 4 // размер gid
+		binary.LittleEndian.PutUint32(owner[11:], st.Gid)
+		extra = owner
+	}
+
+	times := make([]byte, 9)
+	binary.LittleEndian.PutUint16(times[0:], extTimeExtraID)
+	binary.LittleEndian.PutUint16(times[2:], 5)
+	times[4] = 1 // есть только время модификации
+	binary.LittleEndian.PutUint32(times[5:], uint32(mtime.Unix()))
+
+	header.Extra = append(header.Extra, times...)
+	header.Extra = append(header.Extra, extra...)
+}
+
+// encryptionMethod — способ шифрования файлов в архиве
+type encryptionMethod int
+
+const (
+	encryptNone encryptionMethod = iota
+	encryptZipCrypto
+	encryptAES256
+)
+
+func (m encryptionMethod) String() string {
+	switch m {
+	case encryptZipCrypto:
+		return "ZipCrypto"
+	case encryptAES256:
+		return "AES-256"
+	default:
+		return "нет"
+	}
+}
+
+func parseEncryption(name string) (encryptionMethod, error) {
+	switch strings.ToLower(name) {
+	case "zipcrypto", "pkware":
+		return encryptZipCrypto, nil
+	case "aes256", "aes":
+		return encryptAES256, nil
+	default:
+		return encryptNone, fmt.Errorf("неизвестный метод шифрования: %s (допустимо zipcrypto, aes256)", name)
+	}
+}
+
+// Параметры форматов шифрования ZIP
+const (
+	zipFlagEncrypted  = 0x1
+	zipFlagDescriptor = 0x8
+	zipFlagUTF8       = 0x800
+
+	zipCryptoHeaderLen = 12
+
+	// WinZip AES: метод 99 и дополнительное поле 0x9901
+	methodAES        = 99
+	aesExtraID       = 0x9901
+	aesVendorAE2     = 2
+	aesStrength256   = 3
+	aesKeyLen        = 32
+	aesSaltLen       = 16
+	aesVerifierLen   = 2
+	aesMACLen        = 10
+	aesKDFIterations = 1000
+)
+
+// prepareEncryptedHeader отмечает член архива как зашифрованный; у AES
+// настоящий метод сжатия хранится в дополнительном поле 0x9901
+func prepareEncryptedHeader(header *zip.FileHeader, method encryptionMethod) {
+	header.Flags |= zipFlagEncrypted
+	if method != encryptAES256 {
+		return
+	}
+
+	extra := make([]byte, 11)
+	binary.LittleEndian.PutUint16(extra[0:], aesExtraID)
+	binary.LittleEndian.PutUint16(extra[2:], 7)
+	binary.LittleEndian.PutUint16(extra[4:], aesVendorAE2)
+	copy(extra[6:], "AE")
+	extra[8] = aesStrength256
+	binary.LittleEndian.PutUint16(extra[9:], header.Method)
+	header.Extra = append(header.Extra, extra...)
+	header.Method = methodAES
+	header.ReaderVersion = 51
+	header.CreatorVersion = header.CreatorVersion&0xff00 | 51
+}
+
+// entryEncryptor шифрует данные члена архива по мере записи. overhead —
+// длина служебных данных шифра, которая входит в сжатый размер члена.
+type entryEncryptor struct {
+	w         io.Writer
+	zipCrypto *zipCryptoWriter
+	stream    *winZipCTR
+	mac       hash.Hash
+	buf       []byte
+	overhead  int64
+}
+
+// newEntryEncryptor записывает в начало данных члена заголовок шифра:
+// у ZipCrypto — 12 байт, у WinZip AE-2 — соль и проверочное значение
+// пароля
+func newEntryEncryptor(w io.Writer, header *zip.FileHeader, opts *zipOptions) (*entryEncryptor, error) {
+	if opts.encryption == encryptAES256 {
+		salt := make([]byte, aesSaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		encKey, macKey, verifier, err := deriveAESKeys(opts.password, salt)
+		if err != nil {
+			return nil, err
+		}
+		block, err := aes.NewCipher(encKey)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(salt); err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(verifier); err != nil {
+			return nil, err
+		}
+		return &entryEncryptor{
+			w:        w,
+			stream:   newWinZipCTR(block),
+			mac:      hmac.New(sha1.New, macKey),
+			overhead: aesSaltLen + aesVerifierLen + aesMACLen,
+		}, nil
+	}
+
+	// Традиционное шифрование PKWARE: 12 байт заголовка перед данными.
+	// CRC при записи еще неизвестен, поэтому, как в Info-ZIP для членов
+	// с дескриптором данных, последним байтом служит старший байт
+	// времени модификации
+	keys := newZipCryptoKeys(opts.password)
+	encHeader := make([]byte, zipCryptoHeaderLen)
+	if _, err := rand.Read(encHeader[:zipCryptoHeaderLen-1]); err != nil {
+		return nil, err
+	}
+	encHeader[zipCryptoHeaderLen-1] = byte(header.ModifiedTime >> 8)
+	keys.encrypt(encHeader)
+	if _, err := w.Write(encHeader); err != nil {
+		return nil, err
+	}
+	return &entryEncryptor{w: w, zipCrypto: &zipCryptoWriter{w: w, keys: keys}, overhead: zipCryptoHeaderLen}, nil
+}
+
+func (e *entryEncryptor) Write(p []byte) (int, error) {
+	if e.zipCrypto != nil {
+		return e.zipCrypto.Write(p)
+	}
+	e.buf = append(e.buf[:0], p...)
+	e.stream.XORKeyStream(e.buf, e.buf)
+	e.mac.Write(e.buf)
+	return e.w.Write(e.buf)
+}
+
+// finish дописывает код аутентичности HMAC-SHA1 у AES
+func (e *entryEncryptor) finish() error {
+	if e.mac == nil {
+		return nil
+	}
+	_, err := e.w.Write(e.mac.Sum(nil)[:aesMACLen])
+	return err
+}
+
+// deriveAESKeys получает ключ шифрования, ключ HMAC и проверочное
+// значение пароля по PBKDF2-HMAC-SHA1
+func deriveAESKeys(password string, salt []byte) (encKey, macKey, verifier []byte, err error) {
+	key, err := pbkdf2.Key(sha1.New, password, salt, aesKDFIterations, 2*aesKeyLen+aesVerifierLen)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return key[:aesKeyLen], key[aesKeyLen : 2*aesKeyLen], key[2*aesKeyLen:], nil
+}
+
+// winZipCTR — режим CTR в варианте WinZip: 128-битный счетчик
+// в порядке little-endian, начиная с 1
+type winZipCTR struct {
+	block   cipher.Block
+	counter [aes.BlockSize]byte
+	stream  [aes.BlockSize]byte
+	pos     int
+}
+
+func newWinZipCTR(block cipher.Block) *winZipCTR {
+	return &winZipCTR{block: block, pos: aes.BlockSize}
+}
+
+func (c *winZipCTR) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		if c.pos == aes.BlockSize {
+			for j := range c.counter {
+				c.counter[j]++
+				if c.counter[j] != 0 {
+					break
+				}
+			}
+			c.block.Encrypt(c.stream[:], c.counter[:])
+			c.pos = 0
+		}
+		dst[i] = src[i] ^ c.stream[c.pos]
+		c.pos++
+	}
+}
+
+// zipCryptoKeys — состояние традиционного шифра PKWARE
+type zipCryptoKeys [3]uint32
+
+func newZipCryptoKeys(password string) *zipCryptoKeys {
+	keys := &zipCryptoKeys{0x12345678, 0x23456789, 0x34567890}
+	for i := 0; i < len(password); i++ {
+		keys.update(password[i])
+	}
+	return keys
+}
+
+func (k *zipCryptoKeys) update(b byte) {
+	k[0] = crc32.IEEETable[byte(k[0])^b] ^ (k[0] >> 8)
+	k[1] = (k[1]+(k[0]&0xff))*134775813 + 1
+	k[2] = crc32.IEEETable[byte(k[2])^byte(k[1]>>24)] ^ (k[2] >> 8)
+}
+
+func (k *zipCryptoKeys) streamByte() byte {
+	t := k[2] | 2
+	return byte((t * (t ^ 1)) >> 8)
+}
+
+// encrypt шифрует буфер на месте
+func (k *zipCryptoKeys) encrypt(buf []byte) {
+	for i, b := range buf {
+		buf[i] = b ^ k.streamByte()
+		k.update(b)
+	}
+}
+
+// zipCryptoWriter шифрует данные перед записью
+type zipCryptoWriter struct {
+	w    io.Writer
+	keys *zipCryptoKeys
+	buf  []byte
+}
+
+func (z *zipCryptoWriter) Write(p []byte) (int, error) {
+	z.buf = append(z.buf[:0], p...)
+	z.keys.encrypt(z.buf)
+	return z.w.Write(z.buf)
+}
+
+// prepareRawHeader заполняет поля, которые CreateHeader вычисляет сам,
+// а CreateRaw берет из заголовка как есть
+func prepareRawHeader(header *zip.FileHeader) {
+	header.CreatorVersion = header.CreatorVersion&0xff00 | 20
+	header.ReaderVersion = 20
+	if hasNonASCII(header.Name) || hasNonASCII(header.Comment) {
+		header.Flags |= zipFlagUTF8
+	}
+
+	if !header.Modified.IsZero() {
+		header.ModifiedDate, header.ModifiedTime = msDosTime(header.Modified)
+
+		// Расширенная метка времени, как у CreateHeader
+		extra := make([]byte, 9)
+		binary.LittleEndian.PutUint16(extra[0:], extTimeExtraID)
+		binary.LittleEndian.PutUint16(extra[2:], 5)
+		extra[4] = 1 // есть время модификации
+		binary.LittleEndian.PutUint32(extra[5:], uint32(header.Modified.Unix()))
+		header.Extra = append(header.Extra, extra...)
+	}
+}
+
+func hasNonASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return true
+		}
+	}
+	return false
+}
+
+// msDosTime переводит время в формат даты и времени MS-DOS
+func msDosTime(t time.Time) (date, clock uint16) {
+	if t.Year() < 1980 {
+		t = time.Date(1980, 1, 1, 0, 0, 0, 0, t.Location())
+	}
+	date = uint16(t.Day() + int(t.Month())<<5 + (t.Year()-1980)<<9)
+	clock = uint16(t.Second()/2 + t.Minute()<<5 + t.Hour()<<11)
+	return date, clock
+}
+
+// getPassword берет пароль из переменной окружения или запрашивает его
+// с терминала дважды, без отображения вводимых символов
+func getPassword(envName string) (string, error) {
+	if envName != "" {
+		password := os.Getenv(envName)
+		if password == "" {
+			return "", fmt.Errorf("переменная окружения %s не задана или пуста", envName)
+		}
+		return password, nil
+	}
+
+	password, err := readPassword("Введите пароль: ")
+	if err != nil {
+		return "", err
+	}
+	if password == "" {
+		return "", fmt.Errorf("пустой пароль")
+	}
+	again, err := readPassword("Повторите пароль: ")
+	if err != nil {
+		return "", err
+	}
+	if again != password {
+		return "", fmt.Errorf("пароли не совпадают")
+	}
+	return password, nil
+}
+
+// readPassword читает строку с терминала, отключив эхо. Используется
+// /dev/tty, чтобы стандартный ввод оставался свободным для данных.
+func readPassword(prompt string) (string, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", fmt.Errorf("не удалось открыть терминал для ввода пароля (используйте -password-env): %v", err)
+	}
+	defer tty.Close()
+
+	fd := tty.Fd()
+	var state syscall.Termios
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCGETS, uintptr(unsafe.Pointer(&state))); errno != 0 {
+		return "", fmt.Errorf("не удалось настроить терминал: %v", errno)
+	}
+	noEcho := state
+	noEcho.Lflag &^= syscall.ECHO
+	noEcho.Lflag |= syscall.ICANON | syscall.ISIG
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCSETS, uintptr(unsafe.Pointer(&noEcho))); errno != 0 {
+		return "", fmt.Errorf("не удалось настроить терминал: %v", errno)
+	}
+	defer syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCSETS, uintptr(unsafe.Pointer(&state)))
+
+	fmt.Fprint(tty, prompt)
+	line, err := bufio.NewReader(tty).ReadString('\n')
+	fmt.Fprintln(tty)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// Поля составного (split) архива. Архив из частей — обычный ZIP,
+// разрезанный на файлы .z01, .z02, ..., .zip; смещения в центральном
+// каталоге и записях конца каталога отсчитываются от начала части,
+// в которой находится запись, а номер части хранится рядом.
+//
+// Этот блок, до zip64Fields включительно, повторяется в unzip.go:
+// изменения нужно вносить в оба файла. Тест zip_split_test.go
+// проверяет этот код и то, что копии совпадают.
+const (
+	splitMarker       = 0x08074b50 // сигнатура в начале первой части
+	centralHeaderSig  = 0x02014b50
+	directoryEndSig   = 0x06054b50
+	directory64EndSig = 0x06064b50
+	directory64LocSig = 0x07064b50
+	centralHeaderLen  = 46
+	directoryEndLen   = 22
+	directory64EndLen = 56
+	directory64LocLen = 20
+	zip64ExtraID      = 0x0001
+	uint16max         = 0xffff
+	uint32max         = 0xffffffff
+)
+
+// directoryEnd — поля записей конца центрального каталога
+type directoryEnd struct {
+	disk        uint32 // номер части с записью конца каталога
+	cdDisk      uint32 // номер части, где начинается каталог
+	diskEntries uint64 // записей каталога в последней части
+	entries     uint64 // всего записей каталога
+	cdSize      uint64
+	cdOffset    uint64 // смещение каталога от начала его части
+	comment     []byte
+}
+
+// findDirectoryEnd ищет запись конца каталога в хвосте архива;
+// длина комментария должна совпадать с оставшимися байтами
+func findDirectoryEnd(buf []byte) (int, bool) {
+	for i := len(buf) - directoryEndLen; i >= 0; i-- {
+		if binary.LittleEndian.Uint32(buf[i:]) != directoryEndSig {
+			continue
+		}
+		commentLen := int(binary.LittleEndian.Uint16(buf[i+20:]))
+		if i+directoryEndLen+commentLen == len(buf) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// parseDirectoryEnd разбирает запись конца каталога; значения, не
+// поместившиеся в 16 или 32 бита, затем берутся из записи Zip64
+func parseDirectoryEnd(rec []byte) directoryEnd {
+	le := binary.LittleEndian
+	return directoryEnd{
+		disk:        uint32(le.Uint16(rec[4:])),
+		cdDisk:      uint32(le.Uint16(rec[6:])),
+		diskEntries: uint64(le.Uint16(rec[8:])),
+		entries:     uint64(le.Uint16(rec[10:])),
+		cdSize:      uint64(le.Uint32(rec[12:])),
+		cdOffset:    uint64(le.Uint32(rec[16:])),
+		comment:     rec[directoryEndLen:],
+	}
+}
+
+// needsZip64 — не помещается ли какое-то поле в обычную запись
+func (d *directoryEnd) needsZip64() bool {
+	return d.disk >= uint16max || d.cdDisk >= uint16max ||
+		d.diskEntries >= uint16max || d.entries >= uint16max ||
+		d.cdSize >= uint32max || d.cdOffset >= uint32max
+}
+
+// parseDirectory64Locator разбирает локатор Zip64: номер части и
+// смещение записи Zip64 конца каталога
+func parseDirectory64Locator(rec []byte) (uint32, uint64, bool) {
+	if len(rec) < directory64LocLen || binary.LittleEndian.Uint32(rec) != directory64LocSig {
+		return 0, 0, false
+	}
+	return binary.LittleEndian.Uint32(rec[4:]), binary.LittleEndian.Uint64(rec[8:]), true
+}
+
+// applyDirectory64End заменяет поля значениями из записи Zip64
+func (d *directoryEnd) applyDirectory64End(rec []byte) error {
+	le := binary.LittleEndian
+	if len(rec) < directory64EndLen || le.Uint32(rec) != directory64EndSig {
+		return fmt.Errorf("повреждена запись Zip64 конца каталога")
+	}
+	d.disk = le.Uint32(rec[16:])
+	d.cdDisk = le.Uint32(rec[20:])
+	d.diskEntries = le.Uint64(rec[24:])
+	d.entries = le.Uint64(rec[32:])
+	d.cdSize = le.Uint64(rec[40:])
+	d.cdOffset = le.Uint64(rec[48:])
+	return nil
+}
+
+// appendDirectoryEnd дописывает записи конца каталога: при необходимости
+// запись Zip64 и локатор (zip64Offset — смещение записи Zip64 от начала
+// последней части), затем обычную запись с комментарием
+func appendDirectoryEnd(b []byte, d directoryEnd, zip64Offset uint64) []byte {
+	le := binary.LittleEndian
+	if d.needsZip64() {
+		b = le.AppendUint32(b, directory64EndSig)
+		b = le.AppendUint64(b, directory64EndLen-12)
+		b = le.AppendUint16(b, 45) // версия создания
+		b = le.AppendUint16(b, 45) // версия для извлечения
+		b = le.AppendUint32(b, d.disk)
+		b = le.AppendUint32(b, d.cdDisk)
+		b = le.AppendUint64(b, d.diskEntries)
+		b = le.AppendUint64(b, d.entries)
+		b = le.AppendUint64(b, d.cdSize)
+		b = le.AppendUint64(b, d.cdOffset)
+
+		b = le.AppendUint32(b, directory64LocSig)
+		b = le.AppendUint32(b, d.disk)
+		b = le.AppendUint64(b, zip64Offset)
+		b = le.AppendUint32(b, d.disk+1) // всего частей
+	}
+
+	b = le.AppendUint32(b, directoryEndSig)
+	b = le.AppendUint16(b, uint16(min(d.disk, uint16max)))
+	b = le.AppendUint16(b, uint16(min(d.cdDisk, uint16max)))
+	b = le.AppendUint16(b, uint16(min(d.diskEntries, uint16max)))
+	b = le.AppendUint16(b, uint16(min(d.entries, uint16max)))
+	b = le.AppendUint32(b, uint32(min(d.cdSize, uint32max)))
+	b = le.AppendUint32(b, uint32(min(d.cdOffset, uint32max)))
+	b = le.AppendUint16(b, uint16(len(d.comment)))
+	return append(b, d.comment...)
+}
+
+// centralEntryLen возвращает длину записи центрального каталога
+func centralEntryLen(buf []byte) (int, error) {
+	le := binary.LittleEndian
+	if len(buf) < centralHeaderLen || le.Uint32(buf) != centralHeaderSig {
+		return 0, fmt.Errorf("повреждена запись центрального каталога")
+	}
+	n := centralHeaderLen + int(le.Uint16(buf[28:])) + int(le.Uint16(buf[30:])) + int(le.Uint16(buf[32:]))
+	if n > len(buf) {
+		return 0, fmt.Errorf("повреждена запись центрального каталога")
+	}
+	return n, nil
+}
+
+// entryLocation возвращает номер части и смещение локального заголовка
+// члена архива по записи центрального каталога
+func entryLocation(rec []byte) (uint32, uint64) {
+	le := binary.LittleEndian
+	disk := uint32(le.Uint16(rec[34:]))
+	offset := uint64(le.Uint32(rec[42:]))
+
+	// Значения-заполнители означают, что поле лежит в дополнении Zip64,
+	// куда попадают по порядку: размеры, смещение, номер части
+	fields := zip64Fields(rec)
+	next := func(n int) ([]byte, bool) {
+		if len(fields) < n {
+			return nil, false
+		}
+		v := fields[:n]
+		fields = fields[n:]
+		return v, true
+	}
+	if le.Uint32(rec[24:]) == uint32max {
+		next(8)
+	}
+	if le.Uint32(rec[20:]) == uint32max {
+		next(8)
+	}
+	if offset == uint32max {
+		if v, ok := next(8); ok {
+			offset = le.Uint64(v)
+		}
+	}
+	if disk == uint16max {
+		if v, ok := next(4); ok {
+			disk = le.Uint32(v)
+		}
+	}
+	return disk, offset
+}
+
+// relocateEntry возвращает запись центрального каталога с новыми номером
+// части и смещением локального заголовка; дополнение Zip64 собирается
+// заново, остальные дополнительные поля сохраняются
+func relocateEntry(rec []byte, disk uint32, offset uint64) []byte {
+	le := binary.LittleEndian
+	nameLen := int(le.Uint16(rec[28:]))
+	extraLen := int(le.Uint16(rec[30:]))
+	extra := rec[centralHeaderLen+nameLen : centralHeaderLen+nameLen+extraLen]
+
+	// Размеры из старого дополнения Zip64 переносятся как есть
+	var zip64 []byte
+	fields := zip64Fields(rec)
+	for _, pos := range []int{24, 20} {
+		if le.Uint32(rec[pos:]) == uint32max && len(fields) >= 8 {
+			zip64 = append(zip64, fields[:8]...)
+			fields = fields[8:]
+		}
+	}
+
+	fixed := append([]byte(nil), rec[:centralHeaderLen]...)
+	if offset >= uint32max {
+		le.PutUint32(fixed[42:], uint32max)
+		zip64 = le.AppendUint64(zip64, offset)
+	} else {
+		le.PutUint32(fixed[42:], uint32(offset))
+	}
+	if disk >= uint16max {
+		le.PutUint16(fixed[34:], uint16max)
+		zip64 = le.AppendUint32(zip64, disk)
+	} else {
+		le.PutUint16(fixed[34:], uint16(disk))
+	}
+
+	var newExtra []byte
+	if len(zip64) > 0 {
+		newExtra = le.AppendUint16(newExtra, zip64ExtraID)
+		newExtra = le.AppendUint16(newExtra, uint16(len(zip64)))
+		newExtra = append(newExtra, zip64...)
+	}
+	for len(extra) >= 4 {
+		id := le.Uint16(extra)
+		size := min(int(le.Uint16(extra[2:])), len(extra)-4)
+		if id != zip64ExtraID {
+			newExtra = append(newExtra, extra[:4+size]...)
+		}
+		extra = extra[4+size:]
+	}
+	le.PutUint16(fixed[30:], uint16(len(newExtra)))
+
+	out := append(fixed, rec[centralHeaderLen:centralHeaderLen+nameLen]...)
+	out = append(out, newExtra...)
+	return append(out, rec[centralHeaderLen+nameLen+extraLen:]...)
+}
+
+// zip64Fields возвращает данные дополнения Zip64 записи каталога
+func zip64Fields(rec []byte) []byte {
+	le := binary.LittleEndian
+	nameLen := int(le.Uint16(rec[28:]))
+	extraLen := int(le.Uint16(rec[30:]))
+	extra := rec[centralHeaderLen+nameLen : centralHeaderLen+nameLen+extraLen]
+	for len(extra) >= 4 {
+		id := le.Uint16(extra)
+		size := min(int(le.Uint16(extra[2:])), len(extra)-4)
+		if id == zip64ExtraID {
+			return extra[4 : 4+size]
+		}
+		extra = extra[4+size:]
+	}
+	return nil
+}
+
+// minSplitSize — наименьший размер части архива, как в Info-ZIP
+const minSplitSize = 64 << 10
+
+const (
+	splitMarkerLen    = 4
+	singleSplitMarker = 0x30304b50 // "PK00": архив из частей уместился в одну
+)
+
+// splitWriter записывает архив частями не больше limit байт: архив.z01,
+// архив.z02, ..., последняя часть получает имя архива. Данные членов
+// пишутся потоком, в памяти держатся только конец текущей части (чтобы
+// локальный заголовок не разорвался между частями) и хвост, который
+// zip.Writer дописывает при закрытии: в центральном каталоге абсолютные
+// смещения заменяются номерами частей и смещениями внутри них.
+type splitWriter struct {
+	name      string
+	limit     int64
+	cur       *os.File
+	curSize   int64        // байт текущей части уже на диске
+	held      bytes.Buffer // конец текущей части, еще не записанный
+	flushed   int64        // всего байт записано в части
+	starts    []int64      // смещение начала каждой части от начала архива
+	holding   bool
+	tail      bytes.Buffer
+	tailStart int64
+	finished  bool
+}
+
+const (
+	localHeaderSig    = 0x04034b50
+	localHeaderLen    = 30
+	dataDescriptorSig = 0x08074b50 // та же сигнатура, что у splitMarker
+	descriptorLen     = 24         // дескриптор данных Zip64 — самый длинный
+	// splitWindowLen — наибольшая длина локального заголовка
+	splitWindowLen = localHeaderLen + 2*uint16max
+)
+
+// partName возвращает имя части с номером disk (с нуля), пока
+// неизвестно, последняя ли она
+func (s *splitWriter) partName(disk int) string {
+	return strings.TrimSuffix(s.name, filepath.Ext(s.name)) + fmt.Sprintf(".z%02d", disk+1)
+}
+
+// openNext закрывает текущую часть и начинает следующую; первая часть
+// начинается с сигнатуры составного архива
+func (s *splitWriter) openNext() error {
+	if s.cur != nil {
+		if err := s.cur.Close(); err != nil {
+			return err
+		}
+		s.cur = nil
+	}
+
+	disk := len(s.starts)
+	file, err := os.Create(s.partName(disk))
+	if err != nil {
+		return fmt.Errorf("не удалось создать часть архива: %v", err)
+	}
+	s.cur = file
+	s.curSize = 0
+	s.starts = append(s.starts, s.flushed)
+
+	if disk == 0 {
+		return s.writeOut(binary.LittleEndian.AppendUint32(nil, splitMarker))
+	}
+	return nil
+}
+
+// writeOut записывает байты в текущую часть на диске
+func (s *splitWriter) writeOut(b []byte) error {
+	n, err := s.cur.Write(b)
+	s.curSize += int64(n)
+	s.flushed += int64(n)
+	return err
+}
+
+func (s *splitWriter) Write(p []byte) (int, error) {
+	if s.holding {
+		return s.tail.Write(p)
+	}
+	if err := s.put(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// put пишет данные в части. Начало части сразу уходит на диск, а
+// последние байты копятся в памяти, пока не станет ясно, где ее закончить.
+func (s *splitWriter) put(p []byte) error {
+	window := min(s.limit/2, splitWindowLen)
+	for len(p) > 0 {
+		if s.cur == nil {
+			if err := s.openNext(); err != nil {
+				return err
+			}
+		}
+
+		if direct := s.limit - window - s.curSize; s.held.Len() == 0 && direct > 0 {
+			n := min(int64(len(p)), direct)
+			if err := s.writeOut(p[:n]); err != nil {
+				return err
+			}
+			p = p[n:]
+			continue
+		}
+
+		if room := s.limit - s.curSize - int64(s.held.Len()); room > 0 {
+			n := min(int64(len(p)), room)
+			s.held.Write(p[:n])
+			p = p[n:]
+			continue
+		}
+
+		if err := s.cut(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cut заканчивает заполненную часть. Если в ее конце начинается
+// локальный заголовок или дескриптор данных, который не помещается
+// целиком, часть заканчивается перед ним, а он переносится в следующую.
+// Случайное совпадение сигнатуры в данных лишь немного укорачивает часть.
+func (s *splitWriter) cut(next []byte) error {
+	held := s.held.Bytes()
+	buf := append(append([]byte(nil), held...), next[:min(len(next), localHeaderLen)]...)
+
+	cutAt := len(held)
+	for i := 0; i < len(held) && i+4 <= len(buf); i++ {
+		var need int
+		switch binary.LittleEndian.Uint32(buf[i:]) {
+		case localHeaderSig:
+			need = len(buf) + 1 // поля длин еще не получены
+			if i+localHeaderLen <= len(buf) {
+				need = localHeaderLen + int(binary.LittleEndian.Uint16(buf[i+26:])) + int(binary.LittleEndian.Uint16(buf[i+28:]))
+			}
+		case dataDescriptorSig:
+			need = descriptorLen
+		default:
+			continue
+		}
+		if i+need > len(held) {
+			cutAt = i
+			break
+		}
+	}
+	// Пустую часть оставлять нельзя — тогда режем как есть
+	if s.curSize+int64(cutAt) <= splitMarkerLen {
+		cutAt = len(held)
+	}
+
+	if err := s.writeOut(held[:cutAt]); err != nil {
+		return err
+	}
+	carry := append([]byte(nil), held[cutAt:]...)
+	s.held.Reset()
+	if err := s.openNext(); err != nil {
+		return err
+	}
+	return s.put(carry)
+}
+
+// flushHeld записывает накопленный конец части без переноса
+func (s *splitWriter) flushHeld() error {
+	if s.held.Len() == 0 {
+		return nil
+	}
+	err := s.writeOut(s.held.Bytes())
+	s.held.Reset()
+	return err
+}
+
+// reserve начинает новую часть, если n байт не помещаются в текущую
+func (s *splitWriter) reserve(n int) error {
+	if err := s.flushHeld(); err != nil {
+		return err
+	}
+	if s.cur == nil || (s.curSize+int64(n) > s.limit && s.curSize > 0) {
+		return s.openNext()
+	}
+	return nil
+}
+
+// writeWhole записывает запись так, чтобы она не разрывалась между
+// частями, и возвращает номер части и смещение, с которых она началась
+func (s *splitWriter) writeWhole(b []byte) (uint32, uint64, error) {
+	if err := s.reserve(len(b)); err != nil {
+		return 0, 0, err
+	}
+	disk, offset := uint32(len(s.starts)-1), uint64(s.curSize)
+	// Запись длиннее части все же приходится разрезать
+	if s.curSize+int64(len(b)) > s.limit {
+		return disk, offset, s.put(b)
+	}
+	return disk, offset, s.writeOut(b)
+}
+
+// locate переводит смещение от начала архива в номер части и смещение
+// внутри нее
+func (s *splitWriter) locate(offset int64) (uint32, uint64) {
+	disk := sort.Search(len(s.starts), func(i int) bool { return s.starts[i] > offset }) - 1
+	return uint32(disk), uint64(offset - s.starts[disk])
+}
+
+// holdTail включает накопление в памяти: вызывается перед
+// zip.Writer.Close, который дописывает центральный каталог
+func (s *splitWriter) holdTail() {
+	s.holding = true
+	s.tailStart = s.flushed + int64(s.held.Len())
+}
+
+// Close переписывает накопленный центральный каталог с номерами частей,
+// дописывает записи конца каталога в последнюю часть и дает ей имя архива
+func (s *splitWriter) Close() error {
+	s.holding = false
+	tail := s.tail.Bytes()
+
+	endPos, ok := findDirectoryEnd(tail)
+	if !ok {
+		return fmt.Errorf("не найден конец центрального каталога")
+	}
+	end := parseDirectoryEnd(tail[endPos:])
+	if endPos >= directory64LocLen {
+		if _, offset, ok := parseDirectory64Locator(tail[endPos-directory64LocLen:]); ok {
+			pos := int64(offset) - s.tailStart
+			if pos < 0 || pos >= int64(endPos) {
+				return fmt.Errorf("неожиданное положение записи Zip64")
+			}
+			if err := end.applyDirectory64End(tail[pos:]); err != nil {
+				return err
+			}
+		}
+	}
+	cdStart := int64(end.cdOffset) - s.tailStart
+	if cdStart < 0 || cdStart+int64(end.cdSize) > int64(endPos) {
+		return fmt.Errorf("неожиданное положение центрального каталога")
+	}
+
+	// Перед каталогом может остаться дескриптор данных последнего члена;
+	// после него границы частей с данными больше не сдвигаются
+	if err := s.put(tail[:cdStart]); err != nil {
+		return err
+	}
+	if err := s.flushHeld(); err != nil {
+		return err
+	}
+
+	out := directoryEnd{entries: end.entries, comment: end.comment}
+	diskEntries := make(map[uint32]uint64)
+	cd := tail[cdStart : cdStart+int64(end.cdSize)]
+	for i := 0; len(cd) > 0; i++ {
+		n, err := centralEntryLen(cd)
+		if err != nil {
+			return err
+		}
+		_, offset := entryLocation(cd[:n])
+		recDisk, recOffset := s.locate(int64(offset))
+		rec := relocateEntry(cd[:n], recDisk, recOffset)
+		disk, cdOffset, err := s.writeWhole(rec)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			out.cdDisk, out.cdOffset = disk, cdOffset
+		}
+		diskEntries[disk]++
+		out.cdSize += uint64(len(rec))
+		cd = cd[n:]
+	}
+
+	// Записи конца каталога целиком помещаются в последнюю часть
+	endLen := directory64EndLen + directory64LocLen + directoryEndLen + len(out.comment)
+	if err := s.reserve(endLen); err != nil {
+		return err
+	}
+	out.disk = uint32(len(s.starts) - 1)
+	out.diskEntries = diskEntries[out.disk]
+	if end.entries == 0 {
+		out.cdDisk, out.cdOffset = out.disk, uint64(s.curSize)
+	}
+	if _, _, err := s.writeWhole(appendDirectoryEnd(nil, out, uint64(s.curSize))); err != nil {
+		return err
+	}
+
+	// Архив уместился в одну часть — помечаем его как обычный
+	if len(s.starts) == 1 {
+		marker := binary.LittleEndian.AppendUint32(nil, singleSplitMarker)
+		if _, err := s.cur.WriteAt(marker, 0); err != nil {
+			return err
+		}
+	}
+	if err := s.cur.Close(); err != nil {
+		return err
+	}
+	s.cur = nil
+	last := len(s.starts) - 1
+	if err := os.Rename(s.partName(last), s.name); err != nil {
+		return err
+	}
+	s.finished = true
+
+	// Удаляем лишние части, оставшиеся от прежнего архива с тем же именем
+	for disk := last + 1; ; disk++ {
+		if os.Remove(s.partName(disk)) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// discard закрывает и удаляет части недописанного архива
+func (s *splitWriter) discard() {
+	if s.finished {
+		return
+	}
+	if s.cur != nil {
+		s.cur.Close()
+	}
+	for disk := range s.starts {
+		os.Remove(s.partName(disk))
+	}
+}
+
+// isSplitArchive проверяет, последняя ли это часть составного архива
+func isSplitArchive(name string) bool {
+	file, err := os.Open(name)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	tailLen := min(info.Size(), directoryEndLen+uint16max)
+	tail := make([]byte, tailLen)
+	if _, err := file.ReadAt(tail, info.Size()-tailLen); err != nil {
+		return false
+	}
+	endPos, ok := findDirectoryEnd(tail)
+	return ok && parseDirectoryEnd(tail[endPos:]).disk != 0
+}
+
+// parseSize разбирает размер с необязательным суффиксом K, M, G или T
+func parseSize(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, fmt.Errorf("пустой размер")
+	}
+
+	multiplier := int64(1)
+	switch strings.ToUpper(value[len(value)-1:]) {
+	case "K":
+		multiplier = 1 << 10
+	case "M":
+		multiplier = 1 << 20
+	case "G":
+		multiplier = 1 << 30
+	case "T":
+		multiplier = 1 << 40
+	}
+	if multiplier != 1 {
+		value = value[:len(value)-1]
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("неверный размер: %s", value)
+	}
+	if n > (1<<63-1)/multiplier {
+		return 0, fmt.Errorf("слишком большой размер: %s", value)
+	}
+	return n * multiplier, nil
+}
@@ -0,0 +1,196 @@
+// Тесты общего кода составных архивов, который повторяется в zip.go
+// и unzip.go. Каталог содержит несколько программ, поэтому тест
+// запускается с одним из файлов:
+//
+//	go test zip.go zip_split_test.go
+//	go test unzip.go zip_split_test.go
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"strings"
+	"testing"
+)
+
+// centralRecord собирает запись центрального каталога так же, как
+// zip.Writer: значения, которые не помещаются в поле, заменяются
+// заполнителями и попадают в дополнение Zip64 по порядку — размеры,
+// смещение, номер части. extra дописывается после дополнения Zip64.
+func centralRecord(name string, size, compressed uint64, disk uint32, offset uint64, extra []byte, comment string) []byte {
+	le := binary.LittleEndian
+	rec := make([]byte, centralHeaderLen)
+	le.PutUint32(rec[0:], centralHeaderSig)
+	le.PutUint32(rec[16:], 0x12345678) // CRC
+
+	var zip64 []byte
+	if size >= uint32max {
+		le.PutUint32(rec[24:], uint32max)
+		zip64 = le.AppendUint64(zip64, size)
+	} else {
+		le.PutUint32(rec[24:], uint32(size))
+	}
+	if compressed >= uint32max {
+		le.PutUint32(rec[20:], uint32max)
+		zip64 = le.AppendUint64(zip64, compressed)
+	} else {
+		le.PutUint32(rec[20:], uint32(compressed))
+	}
+	if offset >= uint32max {
+		le.PutUint32(rec[42:], uint32max)
+		zip64 = le.AppendUint64(zip64, offset)
+	} else {
+		le.PutUint32(rec[42:], uint32(offset))
+	}
+	if disk >= uint16max {
+		le.PutUint16(rec[34:], uint16max)
+		zip64 = le.AppendUint32(zip64, disk)
+	} else {
+		le.PutUint16(rec[34:], uint16(disk))
+	}
+
+	var fields []byte
+	if len(zip64) > 0 {
+		fields = le.AppendUint16(fields, zip64ExtraID)
+		fields = le.AppendUint16(fields, uint16(len(zip64)))
+		fields = append(fields, zip64...)
+	}
+	fields = append(fields, extra...)
+
+	le.PutUint16(rec[28:], uint16(len(name)))
+	le.PutUint16(rec[30:], uint16(len(fields)))
+	le.PutUint16(rec[32:], uint16(len(comment)))
+	rec = append(rec, name...)
+	rec = append(rec, fields...)
+	return append(rec, comment...)
+}
+
+// recordSizes возвращает исходный и сжатый размеры из записи каталога
+func recordSizes(rec []byte) (uint64, uint64) {
+	le := binary.LittleEndian
+	size := uint64(le.Uint32(rec[24:]))
+	compressed := uint64(le.Uint32(rec[20:]))
+	fields := zip64Fields(rec)
+	if size == uint32max && len(fields) >= 8 {
+		size = le.Uint64(fields)
+		fields = fields[8:]
+	}
+	if compressed == uint32max && len(fields) >= 8 {
+		compressed = le.Uint64(fields)
+	}
+	return size, compressed
+}
+
+func TestRelocateEntry(t *testing.T) {
+	// Расширенная метка времени: должна сохраниться после переноса
+	timestamp := []byte{0x55, 0x54, 5, 0, 1, 0x10, 0x20, 0x30, 0x40}
+
+	tests := []struct {
+		name             string
+		size, compressed uint64
+		disk             uint32
+		offset           uint64
+		newDisk          uint32
+		newOffset        uint64
+		zip64Len         int // длина данных нового дополнения Zip64
+	}{
+		{"обычная запись", 100, 50, 0, 1000, 3, 2000, 0},
+		{"номер части больше 65535", 100, 50, 0, 1000, 70000, 2000, 4},
+		{"номер части 65535 — заполнитель", 100, 50, 0, 1000, uint16max, 2000, 4},
+		{"большое смещение", 100, 50, 0, 1000, 2, 5 << 30, 8},
+		{"размеры в Zip64", 6 << 30, 5 << 30, 0, 1000, 7, 2000, 16},
+		{"размеры в Zip64 и номер части", 6 << 30, 5 << 30, 0, 1000, 70000, 2000, 20},
+		{"все поля в Zip64", 6 << 30, 5 << 30, 80000, 9 << 30, 100000, 8 << 30, 28},
+		{"смещение уходит из Zip64", 100, 50, 70000, 9 << 30, 1, 4096, 0},
+		{"только исходный размер в Zip64", 5 << 30, 100, 0, 0, 70000, 0, 12},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := centralRecord("dir/файл.txt", tt.size, tt.compressed, tt.disk, tt.offset, timestamp, "комментарий")
+			if disk, offset := entryLocation(rec); disk != tt.disk || offset != tt.offset {
+				t.Fatalf("исходная запись: часть %d, смещение %d; ожидалось %d, %d", disk, offset, tt.disk, tt.offset)
+			}
+			n, err := centralEntryLen(rec)
+			if err != nil || n != len(rec) {
+				t.Fatalf("centralEntryLen исходной записи = %d, %v; ожидалось %d", n, err, len(rec))
+			}
+
+			got := relocateEntry(rec, tt.newDisk, tt.newOffset)
+
+			n, err = centralEntryLen(got)
+			if err != nil || n != len(got) {
+				t.Fatalf("centralEntryLen = %d, %v; ожидалось %d", n, err, len(got))
+			}
+			if disk, offset := entryLocation(got); disk != tt.newDisk || offset != tt.newOffset {
+				t.Errorf("часть %d, смещение %d; ожидалось %d, %d", disk, offset, tt.newDisk, tt.newOffset)
+			}
+			if size, compressed := recordSizes(got); size != tt.size || compressed != tt.compressed {
+				t.Errorf("размеры %d/%d; ожидалось %d/%d", size, compressed, tt.size, tt.compressed)
+			}
+			if l := len(zip64Fields(got)); l != tt.zip64Len {
+				t.Errorf("длина дополнения Zip64 %d; ожидалось %d", l, tt.zip64Len)
+			}
+
+			// Запись совпадает с той, что собрана сразу с новыми значениями
+			want := centralRecord("dir/файл.txt", tt.size, tt.compressed, tt.newDisk, tt.newOffset, timestamp, "комментарий")
+			if !bytes.Equal(got, want) {
+				t.Errorf("запись отличается:\n получено  %x\n ожидалось %x", got, want)
+			}
+		})
+	}
+}
+
+// Повторный перенос не должен накапливать дополнения Zip64
+func TestRelocateEntryTwice(t *testing.T) {
+	rec := centralRecord("a", 6<<30, 5<<30, 0, 0, nil, "")
+	once := relocateEntry(rec, 70000, 9<<30)
+	twice := relocateEntry(once, 70000, 9<<30)
+	if !bytes.Equal(once, twice) {
+		t.Errorf("повторный перенос изменил запись:\n %x\n %x", once, twice)
+	}
+}
+
+// sharedBlock возвращает общий код составных архивов из исходного файла:
+// от комментария "Поля составного (split) архива" до конца zip64Fields.
+// Строка со ссылкой на другой файл в копиях различается и пропускается.
+func sharedBlock(t *testing.T, filename string) string {
+	t.Helper()
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(src)
+	start := strings.Index(text, "// Поля составного (split) архива")
+	fn := strings.Index(text, "\nfunc zip64Fields(")
+	if start < 0 || fn < start {
+		t.Fatalf("%s: не найден общий блок", filename)
+	}
+	end := fn + strings.Index(text[fn:], "\n}\n") + len("\n}\n")
+
+	var lines []string
+	for _, line := range strings.Split(text[start:end], "\n") {
+		if !strings.Contains(line, "повторяется в") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Копии общего кода в zip.go и unzip.go должны совпадать
+func TestSharedBlockInSync(t *testing.T) {
+	zipBlock := sharedBlock(t, "zip.go")
+	unzipBlock := sharedBlock(t, "unzip.go")
+	if zipBlock == unzipBlock {
+		return
+	}
+	zipLines := strings.Split(zipBlock, "\n")
+	unzipLines := strings.Split(unzipBlock, "\n")
+	for i := 0; i < len(zipLines) && i < len(unzipLines); i++ {
+		if zipLines[i] != unzipLines[i] {
+			t.Fatalf("общий блок различается в строке %d:\n zip.go:   %s\n unzip.go: %s", i+1, zipLines[i], unzipLines[i])
+		}
+	}
+	t.Fatalf("общий блок различается по длине: %d и %d строк", len(zipLines), len(unzipLines))
+}
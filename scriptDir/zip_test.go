@@ -0,0 +1,470 @@
+// Тесты zip.go. Каталог содержит несколько программ, поэтому тест
+// запускается вместе со своей программой:
+//
+//	go test zip.go zip_test.go
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// byteCounter считает байты, прочитанные распаковщиком. ReadByte нужен,
+// чтобы flate.NewReader не читал дальше конца сжатых данных.
+type byteCounter struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *byteCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *byteCounter) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+// readStream читает архив последовательно, как потоковые распаковщики:
+// только локальные заголовки, данные и дескрипторы данных, без
+// центрального каталога. Возвращает содержимое членов по именам и
+// проверяет, что CRC и размеры в дескрипторах совпадают с данными.
+func readStream(r io.Reader) (map[string][]byte, error) {
+	le := binary.LittleEndian
+	br := bufio.NewReader(r)
+	members := make(map[string][]byte)
+
+	for {
+		head := make([]byte, localHeaderLen)
+		if _, err := io.ReadFull(br, head[:4]); err != nil {
+			return nil, fmt.Errorf("нет конца архива: %v", err)
+		}
+		switch le.Uint32(head) {
+		case localHeaderSig:
+		case centralHeaderSig, directoryEndSig:
+			// Остаток потока можно не читать, как это делают
+			// потоковые распаковщики
+			io.Copy(io.Discard, br)
+			return members, nil
+		default:
+			return nil, fmt.Errorf("неожиданная сигнатура %#x", le.Uint32(head))
+		}
+		if _, err := io.ReadFull(br, head[4:]); err != nil {
+			return nil, err
+		}
+		flags := le.Uint16(head[6:])
+		method := le.Uint16(head[8:])
+		name := make([]byte, le.Uint16(head[26:]))
+		extra := make([]byte, le.Uint16(head[28:]))
+		if _, err := io.ReadFull(br, name); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(br, extra); err != nil {
+			return nil, err
+		}
+
+		var data []byte
+		var compressed int64
+		switch {
+		case flags&zipFlagDescriptor == 0:
+			raw := make([]byte, le.Uint32(head[18:]))
+			if _, err := io.ReadFull(br, raw); err != nil {
+				return nil, err
+			}
+			if method != zip.Store {
+				return nil, fmt.Errorf("%s: метод %d без дескриптора в тесте не поддерживается", name, method)
+			}
+			data, compressed = raw, int64(len(raw))
+		case flags&zipFlagEncrypted != 0:
+			return nil, fmt.Errorf("%s: зашифрованный член с дескриптором нельзя прочитать без пароля", name)
+		case method == zip.Deflate:
+			// Конец сжатых данных определяет сам поток deflate
+			counter := &byteCounter{r: br}
+			var err error
+			if data, err = io.ReadAll(flate.NewReader(counter)); err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+			compressed = counter.n
+		case method == zip.Store:
+			// Длина неизвестна: ищем дескриптор, CRC и размер которого
+			// совпадают с прочитанными данными
+			for {
+				peek, err := br.Peek(12)
+				if err != nil {
+					return nil, fmt.Errorf("%s: не найден дескриптор данных", name)
+				}
+				if le.Uint32(peek) == dataDescriptorSig &&
+					le.Uint32(peek[4:]) == crc32.ChecksumIEEE(data) &&
+					le.Uint32(peek[8:]) == uint32(len(data)) {
+					break
+				}
+				b, _ := br.ReadByte()
+				data = append(data, b)
+			}
+			compressed = int64(len(data))
+		default:
+			return nil, fmt.Errorf("%s: неизвестный метод %d", name, method)
+		}
+
+		if flags&zipFlagDescriptor != 0 {
+			desc := make([]byte, 16)
+			if _, err := io.ReadFull(br, desc); err != nil {
+				return nil, err
+			}
+			if le.Uint32(desc) != dataDescriptorSig {
+				return nil, fmt.Errorf("%s: нет сигнатуры дескриптора данных", name)
+			}
+			crc, csize, usize := le.Uint32(desc[4:]), le.Uint32(desc[8:]), le.Uint32(desc[12:])
+			if crc != crc32.ChecksumIEEE(data) || int64(csize) != compressed || int(usize) != len(data) {
+				return nil, fmt.Errorf("%s: дескриптор (%08x, %d, %d), данные (%08x, %d, %d)",
+					name, crc, csize, usize, crc32.ChecksumIEEE(data), compressed, len(data))
+			}
+		}
+		members[string(name)] = data
+	}
+}
+
+// makeTree создает дерево файлов для архивации и возвращает ожидаемое
+// содержимое членов по именам относительно корня
+func makeTree(t *testing.T) (string, map[string][]byte) {
+	t.Helper()
+	dir := t.TempDir()
+	want := map[string][]byte{
+		"text.txt":       []byte(strings.Repeat("строка текста для сжатия\n", 5000)),
+		"empty":          {},
+		"photo.jpg":      bytes.Repeat([]byte{1, 2, 3, 250}, 3000),
+		"sub/nested.txt": []byte("вложенный файл\n"),
+		"sub/big.log":    bytes.Repeat([]byte("0123456789abcdef"), 400000),
+	}
+	for name, data := range want {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("text.txt", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	want["link"] = []byte("text.txt")
+	// Директории — члены без данных
+	want["sub/"] = nil
+	return dir, want
+}
+
+// testOptions возвращает параметры, как у zip -q -r -y --root=dir
+func testOptions(dir string, jobs int) zipOptions {
+	return zipOptions{
+		recursive:     true,
+		quiet:         true,
+		symlinks:      true,
+		level:         flate.DefaultCompression,
+		jobs:          jobs,
+		root:          dir,
+		storeSuffixes: []string{".jpg"},
+		report:        &entryReport{},
+		log:           io.Discard,
+	}
+}
+
+// checkMembers сравнивает прочитанные члены с ожидаемыми
+func checkMembers(t *testing.T, got, want map[string][]byte) {
+	t.Helper()
+	if len(got) != len(want) {
+		var names []string
+		for name := range got {
+			names = append(names, name)
+		}
+		t.Errorf("членов %d, ожидалось %d: %v", len(got), len(want), names)
+	}
+	for name, data := range want {
+		if g, ok := got[name]; !ok {
+			t.Errorf("нет члена %s", name)
+		} else if !bytes.Equal(g, data) {
+			t.Errorf("%s: %d байт, ожидалось %d", name, len(g), len(data))
+		}
+	}
+}
+
+// Дескрипторы данных должны быть пригодны для чтения архива потоком,
+// без центрального каталога, при любом числе потоков
+func TestStreamDescriptors(t *testing.T) {
+	dir, want := makeTree(t)
+	for _, jobs := range []int{1, 4} {
+		t.Run(fmt.Sprintf("jobs=%d", jobs), func(t *testing.T) {
+			out := filepath.Join(t.TempDir(), "out.zip")
+			if err := createZip(out, []string{dir}, testOptions(dir, jobs)); err != nil {
+				t.Fatal(err)
+			}
+			file, err := os.Open(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			// Только Read: файл не должен читаться с перемещением
+			got, err := readStream(struct{ io.Reader }{file})
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkMembers(t, got, want)
+		})
+	}
+}
+
+// zipToPipe записывает архив в стандартный вывод, как zip - ..., и
+// возвращает конец канала для чтения: читать его можно только потоком
+func zipToPipe(t *testing.T, dir string) (io.Reader, chan error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+
+	stdout := os.Stdout
+	os.Stdout = w
+	done := make(chan error, 1)
+	go func() {
+		err := createZip(stdioName, []string{dir}, testOptions(dir, 4))
+		w.Close()
+		done <- err
+	}()
+	// createZip берет os.Stdout при создании архива, до первой записи
+	t.Cleanup(func() { os.Stdout = stdout })
+	return r, done
+}
+
+// Архив в стандартном выводе читается из канала без перемещения
+func TestStdoutPipe(t *testing.T) {
+	dir, want := makeTree(t)
+	r, done := zipToPipe(t, dir)
+	got, err := readStream(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	checkMembers(t, got, want)
+}
+
+// То же через bsdtar, который читает ZIP из канала потоком
+func TestStdoutPipeBsdtar(t *testing.T) {
+	bsdtar, err := exec.LookPath("bsdtar")
+	if err != nil {
+		t.Skip("bsdtar не найден")
+	}
+	dir, want := makeTree(t)
+	r, done := zipToPipe(t, dir)
+
+	target := t.TempDir()
+	cmd := exec.Command(bsdtar, "-xf", "-", "-C", target)
+	cmd.Stdin = r
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("bsdtar: %v\n%s", err, out)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range want {
+		path := filepath.Join(target, filepath.FromSlash(name))
+		var got []byte
+		switch {
+		case name == "link":
+			// Тип члена хранится только в центральном каталоге, поэтому
+			// при чтении потоком ссылка становится файлом с путем цели
+			link, err := os.Readlink(path)
+			if err != nil {
+				if got, err = os.ReadFile(path); err != nil {
+					t.Errorf("%s: %v", name, err)
+					continue
+				}
+			} else {
+				got = []byte(link)
+			}
+		case strings.HasSuffix(name, "/"):
+			if info, err := os.Stat(path); err != nil || !info.IsDir() {
+				t.Errorf("%s: не директория (%v)", name, err)
+			}
+			continue
+		default:
+			if got, err = os.ReadFile(path); err != nil {
+				t.Errorf("%s: %v", name, err)
+				continue
+			}
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("%s: %d байт, ожидалось %d", name, len(got), len(data))
+		}
+	}
+}
+
+// С -y висячая ссылка в аргументах сохраняется как ссылка, как и при
+// обходе директории
+func TestDanglingLinkArgument(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "f")
+	link := filepath.Join(dir, "l")
+	if err := os.WriteFile(file, []byte("данные"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("missing", link); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(t.TempDir(), "out.zip")
+	if err := createZip(out, []string{file, link}, testOptions(dir, 1)); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := zip.OpenReader(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	var found bool
+	for _, f := range reader.File {
+		if f.Name != "l" {
+			continue
+		}
+		found = true
+		if f.Mode()&os.ModeSymlink == 0 {
+			t.Errorf("l сохранен как %v, а не как ссылка", f.Mode())
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		target, _ := io.ReadAll(rc)
+		rc.Close()
+		if string(target) != "missing" {
+			t.Errorf("цель ссылки %q, ожидалось %q", target, "missing")
+		}
+	}
+	if !found {
+		t.Error("висячая ссылка не попала в архив")
+	}
+}
+
+// decryptMember расшифровывает данные члена архива, сохраненного без
+// сжатия, и проверяет пароль и код аутентичности
+func decryptMember(f *zip.File, password string) ([]byte, error) {
+	rc, err := f.OpenRaw()
+	if err != nil {
+		return nil, err
+	}
+	raw, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.Method == methodAES {
+		if len(raw) < aesSaltLen+aesVerifierLen+aesMACLen {
+			return nil, fmt.Errorf("слишком короткие данные AES")
+		}
+		salt := raw[:aesSaltLen]
+		data := raw[aesSaltLen+aesVerifierLen : len(raw)-aesMACLen]
+		encKey, macKey, verifier, err := deriveAESKeys(password, salt)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(verifier, raw[aesSaltLen:aesSaltLen+aesVerifierLen]) {
+			return nil, fmt.Errorf("неверное проверочное значение пароля")
+		}
+		mac := hmac.New(sha1.New, macKey)
+		mac.Write(data)
+		if !bytes.Equal(mac.Sum(nil)[:aesMACLen], raw[len(raw)-aesMACLen:]) {
+			return nil, fmt.Errorf("неверный код аутентичности")
+		}
+		block, err := aes.NewCipher(encKey)
+		if err != nil {
+			return nil, err
+		}
+		plain := append([]byte(nil), data...)
+		newWinZipCTR(block).XORKeyStream(plain, plain)
+		return plain, nil
+	}
+
+	keys := newZipCryptoKeys(password)
+	plain := make([]byte, len(raw))
+	for i, c := range raw {
+		plain[i] = c ^ keys.streamByte()
+		keys.update(plain[i])
+	}
+	if len(plain) < zipCryptoHeaderLen || plain[zipCryptoHeaderLen-1] != byte(f.ModifiedTime>>8) {
+		return nil, fmt.Errorf("неверный проверочный байт ZipCrypto")
+	}
+	return plain[zipCryptoHeaderLen:], nil
+}
+
+// С -e ссылки шифруются так же, как файлы: путь цели не должен быть
+// виден без пароля
+func TestEncryptedSymlink(t *testing.T) {
+	const password = "пароль"
+	for _, method := range []encryptionMethod{encryptZipCrypto, encryptAES256} {
+		t.Run(method.String(), func(t *testing.T) {
+			dir, want := makeTree(t)
+			opts := testOptions(dir, 2)
+			opts.encryption = method
+			opts.password = password
+
+			out := filepath.Join(t.TempDir(), "out.zip")
+			if err := createZip(out, []string{dir}, opts); err != nil {
+				t.Fatal(err)
+			}
+			raw, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reader, err := zip.NewReader(bytes.NewReader(raw), int64(len(raw)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, f := range reader.File {
+				if strings.HasSuffix(f.Name, "/") {
+					continue
+				}
+				if f.Flags&zipFlagEncrypted == 0 {
+					t.Errorf("%s не зашифрован", f.Name)
+					continue
+				}
+				if f.Name != "link" {
+					continue
+				}
+				if f.Mode()&os.ModeSymlink == 0 {
+					t.Errorf("link сохранен как %v, а не как ссылка", f.Mode())
+				}
+				target, err := decryptMember(f, password)
+				if err != nil {
+					t.Fatalf("link: %v", err)
+				}
+				if !bytes.Equal(target, want["link"]) {
+					t.Errorf("цель ссылки %q, ожидалось %q", target, want["link"])
+				}
+			}
+		})
+	}
+}